@@ -1,9 +1,57 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
 	"log-agent/internal/detector"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "plugin":
+			detector.StartLogDriverPlugin()
+			return
+		case "ship":
+			ship(os.Args[2:])
+			return
+		}
+	}
 	detector.StartCollectors()
 }
+
+// labelFlags collects repeated --label key=value flags.
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelFlags) Set(val string) error {
+	key, value, ok := strings.Cut(val, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("label must be key=value, got %q", val)
+	}
+	l[key] = value
+	return nil
+}
+
+func ship(args []string) {
+	labels := labelFlags{}
+	fs := flag.NewFlagSet("ship", flag.ExitOnError)
+	fs.Var(labels, "label", "label added to every entry, as key=value (repeatable)")
+	fs.Parse(args)
+
+	if err := detector.Ship(labels); err != nil {
+		log.Printf("[ERROR] %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,254 @@
+package audit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+)
+
+const (
+	checkpointFile = "audit.json"
+	checkpointKey  = "offset"
+
+	pollInterval = 500 * time.Millisecond
+)
+
+var errNotDelivered = errors.New("audit event not delivered")
+
+// AuditCollector tails auditd's log and ships one entry per audit event
+// rather than one per record.
+type AuditCollector struct {
+	stopChan    chan struct{}
+	done        chan struct{}
+	Logger      *processor.LogProcessor
+	path        string
+	hostInfo    map[string]string
+	checkpoints *utils.CheckpointStore
+}
+
+func NewAuditCollector(logger *processor.LogProcessor, cfg config.Config) *AuditCollector {
+	return &AuditCollector{
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+		Logger:      logger,
+		path:        cfg.AuditLogPath,
+		hostInfo:    utils.GetHostMetadata(),
+		checkpoints: utils.NewCheckpointStore(filepath.Join(cfg.StateDir, checkpointFile), 5*time.Second),
+	}
+}
+
+func (ac *AuditCollector) Start() {
+	defer close(ac.done)
+	log.Printf("[INFO] Audit log collector started on %s...", ac.path)
+
+	for {
+		// Each attempt reads again from the checkpoint, so it starts with a
+		// fresh correlator and events left pending are read again.
+		events := newCorrelator(ac.emit)
+		err := ac.follow(events)
+		if err == nil {
+			events.expire(true)
+			return
+		}
+		if errors.Is(err, errNotDelivered) {
+			log.Printf("[WARNING] Audit events from %s were not delivered, reading them again from the checkpoint.", ac.path)
+		} else {
+			log.Printf("[ERROR] Failed to read audit log %s: %v", ac.path, err)
+		}
+		select {
+		case <-ac.stopChan:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (ac *AuditCollector) Stop() {
+	log.Println("[WARNING] Stopping Audit log collector...")
+	close(ac.stopChan)
+	select {
+	case <-ac.done:
+	case <-time.After(5 * time.Second):
+	}
+	ac.checkpoints.Close()
+}
+
+// follow reads the audit log from the checkpoint until stopped, following
+// auditd's rotation (audit.log is renamed to audit.log.1). It returns nil once
+// stopped. After a delivery failure it returns errNotDelivered without
+// moving the checkpoint past the failed event, so the next attempt reads it
+// again.
+func (ac *AuditCollector) follow(events *correlator) error {
+	path, offset := ac.resumePosition()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	inode, size, err := statFile(path)
+	if err != nil {
+		return err
+	}
+	if offset > size {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var partial []byte
+	draining := path != ac.path
+
+	for {
+		chunk, readErr := reader.ReadSlice('\n')
+		partial = append(partial, chunk...)
+
+		if readErr == nil {
+			offset += int64(len(partial))
+			ac.handleLine(strings.TrimSuffix(string(partial), "\n"), events)
+			partial = partial[:0]
+			if events.failed {
+				return errNotDelivered
+			}
+			if events.empty() {
+				ac.checkpoints.Set(checkpointKey, fmt.Sprintf("%d:%d", inode, offset))
+			}
+			continue
+		}
+		if errors.Is(readErr, bufio.ErrBufferFull) {
+			continue
+		}
+		if !errors.Is(readErr, io.EOF) {
+			return readErr
+		}
+
+		events.expire(false)
+		if events.failed {
+			return errNotDelivered
+		}
+		if events.empty() {
+			ac.checkpoints.Set(checkpointKey, fmt.Sprintf("%d:%d", inode, offset))
+		}
+
+		// At the end of a rotated file, or of the current one after it was
+		// rotated away: move on to the new audit.log.
+		currentInode, currentSize, statErr := statFile(ac.path)
+		switch {
+		case statErr == nil && (draining || currentInode != inode):
+			if !draining {
+				// Read whatever was written before the rename first.
+				draining = true
+				continue
+			}
+			file.Close()
+			if file, err = os.Open(ac.path); err != nil {
+				return err
+			}
+			if inode, _, err = statFile(ac.path); err != nil {
+				return err
+			}
+			offset, partial, draining = 0, partial[:0], false
+			reader.Reset(file)
+			continue
+		case statErr == nil && currentSize < offset:
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			offset, partial = 0, partial[:0]
+			reader.Reset(file)
+			continue
+		}
+
+		select {
+		case <-ac.stopChan:
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// resumePosition returns the file and offset to start from: the checkpointed
+// file, which may have been rotated to audit.log.1 meanwhile, or the end of
+// the current log on first start.
+func (ac *AuditCollector) resumePosition() (string, int64) {
+	if val, ok := ac.checkpoints.Get(checkpointKey); ok {
+		ino, off, _ := strings.Cut(val, ":")
+		inode, err1 := strconv.ParseUint(ino, 10, 64)
+		offset, err2 := strconv.ParseInt(off, 10, 64)
+		if err1 == nil && err2 == nil {
+			for _, path := range []string{ac.path, ac.path + ".1"} {
+				if current, _, err := statFile(path); err == nil && current == inode {
+					return path, offset
+				}
+			}
+			log.Println("[WARNING] Checkpointed audit log was rotated away, resuming from the current file.")
+			return ac.path, 0
+		}
+	}
+
+	if _, size, err := statFile(ac.path); err == nil {
+		return ac.path, size
+	}
+	return ac.path, 0
+}
+
+func (ac *AuditCollector) handleLine(line string, events *correlator) {
+	if line == "" {
+		return
+	}
+	r, err := parseRecord(line)
+	if err != nil {
+		log.Printf("[WARNING] Skipping malformed audit record: %v", err)
+		return
+	}
+	events.add(r)
+}
+
+func (ac *AuditCollector) emit(ev *event) error {
+	metadata := ev.labels()
+	for k, v := range ac.hostInfo {
+		metadata[k] = v
+	}
+
+	// The message leaves out the event serial, so repeats like failed
+	// logins would look like duplicates.
+	hints := pipeline.EntryHints{
+		Timestamp: ev.ts,
+		Level:     ev.level(),
+		SkipSplit: true,
+		SkipDedup: true,
+	}
+	if err := ac.Logger.ProcessLogWithHints("auditd", ev.message(), hints, metadata); err != nil {
+		log.Printf("[ERROR] Failed to deliver audit event %s: %v", ev.id, err)
+		return err
+	}
+	return nil
+}
+
+func statFile(path string) (uint64, int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fi.Size(), nil
+	}
+	return st.Ino, fi.Size(), nil
+}
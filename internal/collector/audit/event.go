@@ -0,0 +1,200 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventTimeout bounds how long the records of an event are held waiting for
+// its EOE record before the event is shipped as is.
+const eventTimeout = 2 * time.Second
+
+// summaryFields are promoted to labels from the first record that has them.
+var summaryFields = []string{"auid", "uid", "pid", "ses", "exe", "comm", "syscall", "success", "exit", "key", "cwd", "hostname", "addr", "terminal", "cmd", "res"}
+
+type event struct {
+	id       string
+	ts       time.Time
+	records  []record
+	lastSeen time.Time
+}
+
+// correlator groups the records of an event. The kernel writes the records
+// of a syscall event (SYSCALL, EXECVE, CWD, PATH, PROCTITLE) back to back
+// and ends them with EOE; user-space events are a single record. failed is
+// set once an event could not be delivered.
+type correlator struct {
+	pending map[string]*event
+	order   []string
+	emit    func(*event) error
+	failed  bool
+}
+
+func newCorrelator(emit func(*event) error) *correlator {
+	return &correlator{
+		pending: make(map[string]*event),
+		emit:    emit,
+	}
+}
+
+func (c *correlator) add(r record) {
+	if r.typ == "EOE" {
+		c.complete(r.id)
+		return
+	}
+
+	ev, ok := c.pending[r.id]
+	if !ok {
+		// A new event starts: anything but a syscall event still waiting
+		// for its EOE is complete.
+		for _, id := range append([]string(nil), c.order...) {
+			if c.pending[id].records[0].typ != "SYSCALL" {
+				c.complete(id)
+			}
+		}
+		ev = &event{id: r.id, ts: r.ts}
+		c.pending[r.id] = ev
+		c.order = append(c.order, r.id)
+	}
+	ev.records = append(ev.records, r)
+	ev.lastSeen = time.Now()
+}
+
+// expire ships events that have waited longer than eventTimeout, or every
+// pending event when all is set.
+func (c *correlator) expire(all bool) {
+	for _, id := range append([]string(nil), c.order...) {
+		if all || time.Since(c.pending[id].lastSeen) >= eventTimeout {
+			c.complete(id)
+		}
+	}
+}
+
+func (c *correlator) empty() bool {
+	return len(c.pending) == 0
+}
+
+func (c *correlator) complete(id string) {
+	ev, ok := c.pending[id]
+	if !ok {
+		return
+	}
+	delete(c.pending, id)
+	for i, pendingID := range c.order {
+		if pendingID == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	if err := c.emit(ev); err != nil {
+		c.failed = true
+	}
+}
+
+// labels summarizes the event: its type, the identity and outcome fields of
+// its records, the decoded command line and the paths it touched.
+func (ev *event) labels() map[string]string {
+	labels := map[string]string{
+		"audit":    "true",
+		"audit_id": ev.id,
+		"type":     ev.records[0].typ,
+	}
+
+	var paths []string
+	for _, r := range ev.records {
+		for _, key := range summaryFields {
+			if _, ok := labels[key]; ok {
+				continue
+			}
+			if v, ok := r.get(key); ok {
+				labels[key] = v
+			}
+		}
+
+		switch r.typ {
+		case "EXECVE":
+			labels["command"] = execveCommand(r)
+		case "PATH":
+			if name, ok := r.get("name"); ok && name != "(null)" {
+				paths = append(paths, name)
+			}
+		case "PROCTITLE":
+			labels["proctitle"], _ = r.get("proctitle")
+		}
+
+		// Prefer the names auditd resolved itself in the ENRICHED format.
+		if name := r.enriched["SYSCALL"]; name != "" {
+			labels["syscall"] = name
+		}
+		if name := r.enriched["AUID"]; name != "" {
+			labels["auid_name"] = name
+		}
+	}
+	if len(paths) > 0 {
+		labels["paths"] = strings.Join(paths, ",")
+	}
+
+	// User-space records report res=success|failed instead of success=yes|no.
+	if _, ok := labels["success"]; !ok {
+		if res, ok := labels["res"]; ok {
+			labels["success"] = "no"
+			if res == "success" || res == "1" {
+				labels["success"] = "yes"
+			}
+		}
+	}
+	return labels
+}
+
+// message renders the event's records with untrusted values decoded.
+func (ev *event) message() string {
+	var b strings.Builder
+	for i, r := range ev.records {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("type=")
+		b.WriteString(r.typ)
+		for _, f := range r.fields {
+			if strings.ContainsAny(f.value, " \"\t\n") || f.value == "" {
+				fmt.Fprintf(&b, " %s=%q", f.key, f.value)
+			} else {
+				fmt.Fprintf(&b, " %s=%s", f.key, f.value)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (ev *event) level() string {
+	typ := ev.records[0].typ
+	switch {
+	case strings.HasPrefix(typ, "ANOM_"), typ == "AVC", typ == "SECCOMP":
+		return "WARN"
+	}
+	for _, r := range ev.records {
+		if v, ok := r.get("success"); ok && v == "no" {
+			return "WARN"
+		}
+		if v, ok := r.get("res"); ok && (v == "failed" || v == "0") {
+			return "WARN"
+		}
+	}
+	return "INFO"
+}
+
+func execveCommand(r record) string {
+	val, _ := r.get("argc")
+	argc, _ := strconv.Atoi(val)
+	args := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		arg, ok := r.get("a" + strconv.Itoa(i))
+		if !ok {
+			break
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " ")
+}
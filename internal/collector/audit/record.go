@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// enrichedSeparator starts the translated fields (AUID="root") that auditd
+// appends when log_format is ENRICHED.
+const enrichedSeparator = "\x1d"
+
+var argFieldRegex = regexp.MustCompile(`^a\d+$`)
+
+// untrustedFields hold user-controlled strings, which auditd writes quoted
+// when they are plain and hex-encoded when they contain spaces, quotes or
+// control characters.
+var untrustedFields = map[string]bool{
+	"proctitle": true,
+	"name":      true,
+	"cwd":       true,
+	"comm":      true,
+	"exe":       true,
+	"key":       true,
+	"data":      true,
+	"path":      true,
+	"acct":      true,
+	"cmd":       true,
+}
+
+type field struct {
+	key    string
+	value  string
+	quoted bool
+}
+
+// record is one line of audit.log, e.g.
+//
+//	type=SYSCALL msg=audit(1364481363.243:24287): arch=c000003e syscall=2 success=no
+//
+// The msg='...' payload of user-space records is flattened into fields.
+type record struct {
+	typ      string
+	id       string
+	ts       time.Time
+	fields   []field
+	enriched map[string]string
+}
+
+func parseRecord(line string) (record, error) {
+	line, enrichedPart, _ := strings.Cut(line, enrichedSeparator)
+
+	if !strings.HasPrefix(line, "type=") {
+		return record{}, errors.New("missing record type")
+	}
+	typ, rest, _ := strings.Cut(line[len("type="):], " ")
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "msg=audit(") {
+		return record{}, errors.New("missing msg=audit(...) header")
+	}
+	header, body, found := strings.Cut(rest[len("msg=audit("):], ")")
+	if !found {
+		return record{}, errors.New("unterminated msg=audit(...) header")
+	}
+	stamp, serial, found := strings.Cut(header, ":")
+	if !found {
+		return record{}, errors.New("malformed event id")
+	}
+	ts, err := parseStamp(stamp)
+	if err != nil {
+		return record{}, err
+	}
+
+	r := record{
+		typ:    typ,
+		id:     stamp + ":" + serial,
+		ts:     ts,
+		fields: decodeFields(typ, splitFields(strings.TrimPrefix(body, ":"))),
+	}
+	if enrichedPart != "" {
+		r.enriched = make(map[string]string)
+		for _, f := range splitFields(enrichedPart) {
+			r.enriched[f.key] = f.value
+		}
+	}
+	return r, nil
+}
+
+func (r record) get(key string) (string, bool) {
+	for _, f := range r.fields {
+		if f.key == key {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+// splitFields tokenizes `key=value` pairs whose values may be double or
+// single quoted. A single-quoted msg payload is split in turn.
+func splitFields(s string) []field {
+	var fields []field
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return fields
+		}
+
+		eq := strings.IndexAny(s, "= ")
+		if eq < 0 || s[eq] == ' ' {
+			// A bare word without a value; skip it.
+			if eq < 0 {
+				return fields
+			}
+			s = s[eq:]
+			continue
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value string
+		quoted := false
+		if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+			quote := s[0]
+			end := strings.IndexByte(s[1:], quote)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+			quoted = true
+			if quote == '\'' && key == "msg" {
+				fields = append(fields, splitFields(value)...)
+				continue
+			}
+		} else if end := strings.IndexByte(s, ' '); end >= 0 {
+			value, s = s[:end], s[end:]
+		} else {
+			value, s = s, ""
+		}
+
+		fields = append(fields, field{key: key, value: value, quoted: quoted})
+	}
+}
+
+// decodeFields turns hex-encoded untrusted values back into text. Quoted
+// values are always literal.
+func decodeFields(typ string, fields []field) []field {
+	for i, f := range fields {
+		if f.quoted {
+			continue
+		}
+		if untrustedFields[f.key] || (typ == "EXECVE" && argFieldRegex.MatchString(f.key)) {
+			if decoded, ok := decodeHex(f.value); ok {
+				if f.key == "proctitle" {
+					// The process title keeps argv's NUL separators.
+					decoded = strings.ReplaceAll(strings.TrimRight(decoded, "\x00"), "\x00", " ")
+				}
+				fields[i].value = decoded
+			}
+		}
+	}
+	return fields
+}
+
+func decodeHex(val string) (string, bool) {
+	if len(val) == 0 || len(val)%2 != 0 {
+		return "", false
+	}
+	data, err := hex.DecodeString(val)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func parseStamp(stamp string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(stamp, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("malformed event timestamp")
+	}
+	ms, _ := strconv.ParseInt(frac, 10, 64)
+	return time.Unix(s, ms*int64(time.Millisecond)).UTC(), nil
+}
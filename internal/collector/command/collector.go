@@ -0,0 +1,193 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = 30 * time.Second
+
+	// stopGracePeriod is how long a command has to exit after SIGTERM
+	// before it is killed.
+	stopGracePeriod = 5 * time.Second
+)
+
+// CommandCollector ships the output of configured commands, either run on
+// an interval or kept running as long-lived processes.
+type CommandCollector struct {
+	Logger       *processor.LogProcessor
+	commands     []config.ExecCommand
+	maxLineBytes int
+	hostInfo     map[string]string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+func NewCommandCollector(logger *processor.LogProcessor, cfg config.Config) *CommandCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CommandCollector{
+		Logger:       logger,
+		commands:     cfg.ExecCommands,
+		maxLineBytes: cfg.MaxLineBytes,
+		hostInfo:     utils.GetHostMetadata(),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+func (cc *CommandCollector) Start() {
+	log.Printf("[INFO] Command Collector started with %d commands...", len(cc.commands))
+	for _, c := range cc.commands {
+		cc.wg.Add(1)
+		go func(c config.ExecCommand) {
+			defer cc.wg.Done()
+			if c.Interval > 0 {
+				cc.runPeriodic(c)
+			} else {
+				cc.runSupervised(c)
+			}
+		}(c)
+	}
+}
+
+func (cc *CommandCollector) Stop() {
+	log.Println("[WARNING] Stopping Command Collector...")
+	cc.cancel()
+	cc.wg.Wait()
+}
+
+// runPeriodic runs the command every interval. A run still going when the
+// next one is due is stopped first, so runs never overlap.
+func (cc *CommandCollector) runPeriodic(c config.ExecCommand) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(cc.ctx, c.Interval)
+		if err := cc.run(ctx, c); err != nil && cc.ctx.Err() == nil {
+			log.Printf("[WARNING] Command %s failed: %v", c.Name, err)
+		}
+		cancel()
+
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runSupervised keeps a long-running command alive, restarting it with
+// exponential backoff when it exits. The backoff resets once a run has lasted
+// longer than the maximum backoff.
+func (cc *CommandCollector) runSupervised(c config.ExecCommand) {
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		err := cc.run(cc.ctx, c)
+		if cc.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("exited")
+		}
+
+		if time.Since(started) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+		log.Printf("[WARNING] Command %s stopped (%v), restarting in %s", c.Name, err, backoff)
+
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// run executes the command through the shell, shipping stdout and stderr
+// line by line until it exits.
+func (cc *CommandCollector) run(ctx context.Context, c config.ExecCommand) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.Command)
+	// Run the command in its own process group so pipelines and children
+	// are stopped along with the shell.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = stopGracePeriod
+
+	// Output goes through io.Pipe rather than the command's own pipes so
+	// that Wait, bounded by WaitDelay, also ends the readers when a stopped
+	// command's children still hold the pipes open.
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		cc.readStream(c, "stdout", stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		cc.readStream(c, "stderr", stderr)
+	}()
+
+	err := cmd.Wait()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+	return err
+}
+
+func (cc *CommandCollector) readStream(c config.ExecCommand, stream string, r io.Reader) {
+	reader := utils.NewLineReader(r, cc.maxLineBytes)
+	for {
+		line, truncated, err := reader.ReadLine()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("[ERROR] Failed to read %s of command %s: %v", stream, c.Name, err)
+			}
+			return
+		}
+		if line == "" {
+			continue
+		}
+
+		metadata := make(map[string]string, len(cc.hostInfo)+3)
+		for k, v := range cc.hostInfo {
+			metadata[k] = v
+		}
+		metadata["command"] = c.Name
+		metadata["stream"] = stream
+		if truncated {
+			metadata["truncated"] = "true"
+		}
+
+		// Periodic commands print the same lines on every run, and each run
+		// is worth shipping.
+		hints := pipeline.EntryHints{SkipDedup: true}
+		cc.Logger.ProcessLogWithHints(c.Name, line, hints, metadata)
+	}
+}
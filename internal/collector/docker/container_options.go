@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+)
+
+const (
+	labelEnable           = "loggyto.enable"
+	labelParser           = "loggyto.parser"
+	labelMultilinePattern = "loggyto.multiline.pattern"
+	labelRoute            = "loggyto.route"
+
+	parserAuto = ""
+	parserJSON = "json"
+	parserRaw  = "raw"
+
+	multilineFlushTimeout = time.Second
+)
+
+// containerOptions is the per-container collection config read from
+// `loggyto.*` labels, so Compose and Swarm services can configure their
+// logging next to their own definition.
+type containerOptions struct {
+	parser    string
+	multiline *regexp.Regexp
+	route     string
+}
+
+func parseContainerOptions(containerName string, labels map[string]string) containerOptions {
+	opts := containerOptions{route: labels[labelRoute]}
+
+	switch parser := labels[labelParser]; parser {
+	case parserAuto, parserJSON, parserRaw:
+		opts.parser = parser
+	default:
+		log.Printf("[WARNING] Unknown parser %q for container %s, using automatic parsing.", parser, containerName)
+	}
+
+	if pattern := labels[labelMultilinePattern]; pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("[WARNING] Invalid multiline pattern for container %s: %v", containerName, err)
+		} else {
+			opts.multiline = re
+		}
+	}
+
+	return opts
+}
+
+func (o containerOptions) process(logger *processor.LogProcessor, source, msg string, hints pipeline.EntryHints, metadata map[string]string) error {
+	switch o.parser {
+	case parserJSON:
+		return logger.ProcessJSONLog(source, msg, hints, metadata)
+	case parserRaw:
+		hints.SkipSplit = true
+	}
+	return logger.ProcessLogWithHints(source, msg, hints, metadata)
+}
+
+// multilineAggregator joins continuation lines onto the previous message until
+// a line matching the start pattern arrives or the stream goes quiet.
+type multilineAggregator struct {
+	pattern *regexp.Regexp
+	emit    func(msg string, firstTS, lastTS time.Time, truncated bool, pos fileCheckpoint)
+
+	mu        sync.Mutex
+	lines     []string
+	firstTS   time.Time
+	lastTS    time.Time
+	truncated bool
+	pos       fileCheckpoint
+	timer     *time.Timer
+}
+
+func newMultilineAggregator(pattern *regexp.Regexp, emit func(string, time.Time, time.Time, bool, fileCheckpoint)) *multilineAggregator {
+	return &multilineAggregator{pattern: pattern, emit: emit}
+}
+
+func (m *multilineAggregator) add(line string, firstTS, lastTS time.Time, truncated bool, pos fileCheckpoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.lines) > 0 && m.pattern.MatchString(line) {
+		m.flushLocked()
+	}
+	if len(m.lines) == 0 {
+		m.firstTS = firstTS
+	}
+	m.lines = append(m.lines, line)
+	m.lastTS = lastTS
+	m.truncated = m.truncated || truncated
+	m.pos = pos
+
+	if m.timer == nil {
+		m.timer = time.AfterFunc(multilineFlushTimeout, m.flush)
+	} else {
+		m.timer.Reset(multilineFlushTimeout)
+	}
+}
+
+func (m *multilineAggregator) flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushLocked()
+}
+
+func (m *multilineAggregator) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.flushLocked()
+}
+
+func (m *multilineAggregator) flushLocked() {
+	if len(m.lines) == 0 {
+		return
+	}
+	m.emit(strings.Join(m.lines, "\n"), m.firstTS, m.lastTS, m.truncated, m.pos)
+	m.lines = m.lines[:0]
+	m.truncated = false
+}
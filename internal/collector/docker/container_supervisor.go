@@ -0,0 +1,193 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	minStreamBackoff = time.Second
+	maxStreamBackoff = 30 * time.Second
+)
+
+type streamState string
+
+const (
+	stateAttaching  streamState = "attaching"
+	stateStreaming  streamState = "streaming"
+	stateBackingOff streamState = "backing_off"
+	stateDelegated  streamState = "delegated"
+	stateStopped    streamState = "stopped"
+)
+
+var (
+	errContainerNotRunning = errors.New("container is not running")
+	errLogsDelegated       = errors.New("logs are collected by another collector")
+	errUnsupportedDriver   = errors.New("unsupported log driver")
+	errNotDelivered        = errors.New("log message not delivered")
+)
+
+// ContainerStreamStatus is the introspection view of one container's log
+// stream supervisor.
+type ContainerStreamStatus struct {
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	State         string    `json:"state"`
+	Since         time.Time `json:"since"`
+	LastError     string    `json:"last_error,omitempty"`
+	Reconnects    int       `json:"reconnects"`
+}
+
+// containerSupervisor owns the log stream of a single container for as long
+// as the container runs, re-attaching with backoff when the stream breaks.
+type containerSupervisor struct {
+	containerID   string
+	containerName string
+	cancel        context.CancelFunc
+
+	mu         sync.Mutex
+	state      streamState
+	since      time.Time
+	lastError  error
+	reconnects int
+}
+
+func (s *containerSupervisor) setState(state streamState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != state {
+		s.since = time.Now()
+	}
+	s.state = state
+	if err != nil {
+		s.lastError = err
+	}
+}
+
+func (s *containerSupervisor) getState() streamState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *containerSupervisor) status() ContainerStreamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := ContainerStreamStatus{
+		ContainerID:   s.containerID,
+		ContainerName: s.containerName,
+		State:         string(s.state),
+		Since:         s.since,
+		Reconnects:    s.reconnects,
+	}
+	if s.lastError != nil {
+		st.LastError = s.lastError.Error()
+	}
+	return st
+}
+
+func (cc *DockerCollector) superviseContainer(containerID, containerName string) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if _, exists := cc.logTrackers[containerID]; exists {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(cc.ctx)
+	sup := &containerSupervisor{
+		containerID:   containerID,
+		containerName: containerName,
+		cancel:        cancel,
+		state:         stateAttaching,
+		since:         time.Now(),
+	}
+	cc.logTrackers[containerID] = sup
+
+	go cc.runSupervisor(ctx, sup)
+	return true
+}
+
+func (cc *DockerCollector) runSupervisor(ctx context.Context, sup *containerSupervisor) {
+	backoff := minStreamBackoff
+
+	for {
+		sup.setState(stateAttaching, nil)
+		err := StartLogStream(ctx, cc.client, sup.containerID, sup.containerName, cc.Logger, cc)
+
+		switch {
+		case ctx.Err() != nil, errors.Is(err, errContainerNotRunning):
+			sup.setState(stateStopped, nil)
+			cc.removeSupervisor(sup)
+			return
+		case errors.Is(err, errLogsDelegated):
+			sup.setState(stateDelegated, nil)
+			<-ctx.Done()
+			sup.setState(stateStopped, nil)
+			return
+		case errors.Is(err, errUnsupportedDriver):
+			// Stay registered so the poller doesn't retry every tick.
+			sup.setState(stateStopped, err)
+			return
+		}
+
+		// A stream that delivered before failing starts over at the minimum
+		// backoff, unless it was the delivery that failed.
+		if sup.getState() == stateStreaming && !errors.Is(err, errNotDelivered) {
+			backoff = minStreamBackoff
+		}
+		if err != nil {
+			log.Printf("[WARNING] Log stream for container %s failed, retrying in %s: %v", sup.containerName, backoff, err)
+		}
+		sup.setState(stateBackingOff, err)
+
+		select {
+		case <-ctx.Done():
+			sup.setState(stateStopped, nil)
+			cc.removeSupervisor(sup)
+			return
+		case <-time.After(backoff):
+		}
+
+		sup.mu.Lock()
+		sup.reconnects++
+		sup.mu.Unlock()
+		backoff = min(backoff*2, maxStreamBackoff)
+	}
+}
+
+func (cc *DockerCollector) markStreaming(containerID string) {
+	cc.mu.Lock()
+	sup, ok := cc.logTrackers[containerID]
+	cc.mu.Unlock()
+	if ok {
+		sup.setState(stateStreaming, nil)
+	}
+}
+
+func (cc *DockerCollector) removeSupervisor(sup *containerSupervisor) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.logTrackers[sup.containerID] == sup {
+		delete(cc.logTrackers, sup.containerID)
+	}
+}
+
+// Status reports the state of every supervised container log stream.
+func (cc *DockerCollector) Status() any {
+	cc.mu.Lock()
+	statuses := make([]ContainerStreamStatus, 0, len(cc.logTrackers))
+	for _, sup := range cc.logTrackers {
+		statuses = append(statuses, sup.status())
+	}
+	cc.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ContainerName < statuses[j].ContainerName
+	})
+	return statuses
+}
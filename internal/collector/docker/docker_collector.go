@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"log"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -19,38 +20,74 @@ import (
 type DockerCollector struct {
 	client      *client.Client
 	stopChan    chan struct{}
-	logTrackers map[string]struct{}
+	logTrackers map[string]*containerSupervisor
 	mu          sync.Mutex
 	Logger      *processor.LogProcessor
 	hostInfo    map[string]string
 	cfg         config.Config
-	ctx         context.Context
-	cancel      context.CancelFunc
+	containers  *utils.ContainerRegistry
+	checkpoints *utils.CheckpointStore
+
+	// journaldActive reports whether a journald collector ships the logs of
+	// containers using the journald driver. Remote engines write to their
+	// own host's journal, so it is only set for local sockets.
+	journaldActive bool
+
+	imageDigests    sync.Map
+	oomKilled       sync.Map
+	lifecycleEvents chan dockerevents.Message
+
+	ignoredContainers  *utils.PatternList
+	ignoredImages      *utils.PatternList
+	includedContainers *utils.PatternList
+	includedImages     *utils.PatternList
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	checkpointMu sync.Mutex
 }
 
-func NewContainerCollector(logger *processor.LogProcessor, cfg config.Config) *DockerCollector {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func NewContainerCollector(logger *processor.LogProcessor, cfg config.Config, containers *utils.ContainerRegistry, endpoint string, journaldActive bool) *DockerCollector {
+	cli, err := newDockerClient(endpoint, cfg)
 	if err != nil {
-		log.Fatalf("[ERROR] Error creating Docker client: %v", err)
+		log.Fatalf("[ERROR] Error creating Docker client for %s: %v", endpoint, err)
 	}
 
+	engineHost := engineHostName(endpoint)
+	hostInfo := utils.GetHostMetadata()
+	hostInfo["engine_host"] = engineHost
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &DockerCollector{
 		client:      cli,
 		stopChan:    make(chan struct{}),
-		logTrackers: make(map[string]struct{}),
+		logTrackers: make(map[string]*containerSupervisor),
 		Logger:      logger,
-		hostInfo:    utils.GetHostMetadata(),
+		hostInfo:    hostInfo,
 		cfg:         cfg,
-		ctx:         ctx,
-		cancel:      cancel,
+		containers:  containers,
+		checkpoints: utils.NewCheckpointStore(filepath.Join(cfg.StateDir, checkpointFileName(endpoint)), 5*time.Second),
+
+		journaldActive: journaldActive && !strings.HasPrefix(endpoint, "tcp://"),
+
+		lifecycleEvents: make(chan dockerevents.Message, lifecycleEventQueueSize),
+
+		ignoredContainers:  utils.NewPatternList(cfg.IgnoredContainers),
+		ignoredImages:      utils.NewPatternList(cfg.IgnoredImages),
+		includedContainers: utils.NewPatternList(cfg.IncludedContainers),
+		includedImages:     utils.NewPatternList(cfg.IncludedImages),
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
 func (cc *DockerCollector) Start() {
-	log.Println("[INFO] Docker Collector started...")
+	log.Printf("[INFO] Docker Collector started for %s...", cc.client.DaemonHost())
 	go cc.watchDockerEvents()
+	go cc.shipLifecycleEvents()
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -80,37 +117,36 @@ func (cc *DockerCollector) collectContainers() {
 		containerID := cont.ID
 		containerName := strings.TrimPrefix(cont.Names[0], "/")
 
-		if cc.shouldIgnore(containerName) {
+		if cc.shouldIgnore(containerName, cont.Image, cont.Labels) {
 			continue
 		}
 
-		cc.mu.Lock()
-		if _, exists := cc.logTrackers[containerID]; exists {
-			cc.mu.Unlock()
-			continue
-		}
-		cc.logTrackers[containerID] = struct{}{}
-		cc.mu.Unlock()
-
-		go cc.startContainerLogStream(containerID, containerName)
+		cc.superviseContainer(containerID, containerName)
 	}
 }
 
-func (cc *DockerCollector) shouldIgnore(containerName string) bool {
-	for _, ignored := range cc.cfg.IgnoredContainers {
-		if ignored == containerName {
-			log.Printf("[INFO] Ignoring container %s", containerName)
-			return true
-		}
+// shouldIgnore applies the `loggyto.enable` label first, so a container can
+// always opt in or out explicitly, then the name and image patterns. In
+// opt-in mode the include patterns opt containers in just like the label.
+func (cc *DockerCollector) shouldIgnore(containerName, image string, labels map[string]string) bool {
+	switch labels[labelEnable] {
+	case "false":
+		return true
+	case "true":
+		return false
 	}
-	return false
-}
-
-func (cc *DockerCollector) startContainerLogStream(containerID, containerName string) {
-	ctx, cancel := context.WithTimeout(cc.ctx, 10*time.Second)
-	defer cancel()
 
-	StartLogStream(ctx, cc.client, containerID, containerName, cc.Logger, cc)
+	if cc.ignoredContainers.Match(containerName) || cc.ignoredImages.Match(image) {
+		return true
+	}
+	included := cc.includedContainers.Match(containerName) || cc.includedImages.Match(image)
+	if cc.cfg.DockerOptIn {
+		return !included
+	}
+	if cc.includedContainers.Empty() && cc.includedImages.Empty() {
+		return false
+	}
+	return !included
 }
 
 func (cc *DockerCollector) Stop() {
@@ -118,6 +154,7 @@ func (cc *DockerCollector) Stop() {
 	cc.cancel()
 	close(cc.stopChan)
 	cc.client.Close()
+	cc.checkpoints.Close()
 }
 
 func (cc *DockerCollector) watchDockerEvents() {
@@ -160,34 +197,39 @@ func (cc *DockerCollector) handleDockerEvent(event dockerevents.Message) {
 	containerID := event.Actor.ID
 	containerName := event.Actor.Attributes["name"]
 
+	cc.queueLifecycleEvent(event)
+
 	switch event.Action {
 	case "start":
-		cc.handleContainerStarted(containerID, containerName)
+		cc.handleContainerStarted(containerID, containerName, event.Actor.Attributes)
 	case "die", "stop", "kill":
 		cc.handleContainerStopped(containerID, containerName, string(event.Action))
+	case "destroy":
+		cc.checkpoints.Delete(containerID)
+		cc.checkpoints.Delete(fileCheckpointKey(containerID))
 	}
 }
 
-func (cc *DockerCollector) handleContainerStarted(containerID, containerName string) {
-	if cc.shouldIgnore(containerName) {
+func (cc *DockerCollector) handleContainerStarted(containerID, containerName string, attributes map[string]string) {
+	if cc.shouldIgnore(containerName, attributes["image"], attributes) {
+		log.Printf("[INFO] Ignoring container %s", containerName)
 		return
 	}
 
-	cc.mu.Lock()
-	if _, exists := cc.logTrackers[containerID]; exists {
-		cc.mu.Unlock()
-		return
+	if cc.superviseContainer(containerID, containerName) {
+		log.Printf("[INFO] Detected new container: %s. Starting log stream...", containerName)
 	}
-	cc.logTrackers[containerID] = struct{}{}
-	cc.mu.Unlock()
-
-	log.Printf("[INFO] Detected new container: %s. Starting log stream...", containerName)
-	go cc.startContainerLogStream(containerID, containerName)
 }
 
 func (cc *DockerCollector) handleContainerStopped(containerID, containerName, reason string) {
 	log.Printf("[WARNING] Container %s (%s) has stopped. Reason: %s", containerName, containerID[:12], reason)
+	// Streamed containers are left to drain their remaining output; the
+	// supervisor stops on its own once the container is no longer running.
 	cc.mu.Lock()
-	delete(cc.logTrackers, containerID)
+	if sup, ok := cc.logTrackers[containerID]; ok && sup.getState() != stateStreaming {
+		sup.cancel()
+		delete(cc.logTrackers, containerID)
+	}
 	cc.mu.Unlock()
+	cc.containers.Unregister(containerID)
 }
@@ -1,17 +1,13 @@
 package docker
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
 
 	"log-agent/internal/processor"
 )
@@ -23,107 +19,112 @@ func StartLogStream(
 	containerName string,
 	logger *processor.LogProcessor,
 	cc *DockerCollector,
-) {
-	defer cc.removeLogTracker(containerID)
-
+) error {
 	containerJSON, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
-		log.Printf("[ERROR] Error inspecting container %s: %v", containerID, err)
-		return
+		if client.IsErrNotFound(err) {
+			return errContainerNotRunning
+		}
+		return fmt.Errorf("inspecting container: %w", err)
 	}
 
 	state := containerJSON.State
 	if state == nil || !state.Running {
-		log.Printf("[WARNING] Container %s is not running (status: %s), skipping log stream.", containerID, state.Status)
-		return
+		return errContainerNotRunning
 	}
 
-	if containerJSON.HostConfig.LogConfig.Type != "json-file" {
-		log.Printf("[ERROR] Unsupported log driver for container %s: %s", containerID, containerJSON.HostConfig.LogConfig.Type)
-		return
+	enrichedMeta := cc.containerMetadata(ctx, containerJSON, containerID, containerName)
+
+	options := parseContainerOptions(containerName, containerJSON.Config.Labels)
+	if options.route != "" {
+		enrichedMeta["route"] = options.route
+	}
+
+	switch driver := containerJSON.HostConfig.LogConfig.Type; driver {
+	case "json-file", "local":
+	case "journald":
+		// Without a journald collector running, the API still serves these
+		// logs by reading them back from the journal.
+		if cc.journaldActive {
+			log.Printf("[INFO] Container %s uses the journald log driver, collecting through journald.", containerName)
+			cc.containers.Register(containerID, enrichedMeta)
+			return errLogsDelegated
+		}
+	default:
+		log.Printf("[ERROR] Unsupported log driver for container %s: %s", containerID, driver)
+		return fmt.Errorf("%w: %s", errUnsupportedDriver, driver)
+	}
+
+	if cc.cfg.DockerMode == dockerModeFile && containerJSON.HostConfig.LogConfig.Type == "json-file" {
+		reader := newMessageReader(cc, logger, containerID, containerName, enrichedMeta, time.Time{}, options)
+		defer reader.close()
+
+		cc.markStreaming(containerID)
+		return cc.tailJSONFile(ctx, containerID, cc.jsonFileLogPath(containerID, containerJSON.LogPath), reader)
 	}
 
 	logOptions := container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
 		Follow:     true,
-		Tail:       "0",
+		Timestamps: true,
+		Tail:       cc.cfg.DockerInitialTail,
 	}
 
-	var logReader io.ReadCloser
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		logReader, err = cli.ContainerLogs(ctx, containerID, logOptions)
-		if err == nil {
-			break
-		}
-		log.Printf("[WARNING] Retrying to get logs for container %s (%d/%d)...", containerID, i+1, maxRetries)
-		time.Sleep(time.Duration(2<<i) * time.Millisecond)
+	since, resumed := cc.loadCheckpoint(containerID)
+	if resumed {
+		logOptions.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+		logOptions.Tail = ""
+		log.Printf("[INFO] Resuming logs for container %s since %s", containerName, since.Format(time.RFC3339Nano))
 	}
+
+	logReader, err := cli.ContainerLogs(ctx, containerID, logOptions)
 	if err != nil {
-		log.Printf("[ERROR] Failed to get logs for container %s after retries: %v", containerID, err)
-		return
+		return fmt.Errorf("opening log stream: %w", err)
 	}
 	defer logReader.Close()
 
-	enrichedMeta := map[string]string{
-		"container_id":   containerID,
-		"container_name": containerName,
-	}
-	for k, v := range containerJSON.Config.Labels {
-		enrichedMeta[fmt.Sprintf("label_%s", k)] = v
-	}
+	cc.markStreaming(containerID)
+
+	reader := newMessageReader(cc, logger, containerID, containerName, enrichedMeta, since, options)
+	defer reader.close()
 
 	if containerJSON.Config.Tty {
-		readStream(logReader, containerID, containerName, logger, enrichedMeta)
+		err = reader.readRaw(logReader)
 	} else {
-		stdoutReader, stdoutWriter := io.Pipe()
-		stderrReader, stderrWriter := io.Pipe()
-
-		var wg sync.WaitGroup
-		wg.Add(3)
-
-		go func() {
-			defer wg.Done()
-			readStream(stdoutReader, containerID, containerName, logger, enrichedMeta)
-		}()
-
-		go func() {
-			defer wg.Done()
-			readStream(stderrReader, containerID, containerName, logger, enrichedMeta)
-		}()
-
-		go func() {
-			defer wg.Done()
-			_, err := stdcopy.StdCopy(stdoutWriter, stderrWriter, logReader)
-			if err != nil {
-				log.Printf("[ERROR] Error reading multiplexed logs for %s: %v", containerID, err)
-			}
-			stdoutWriter.Close()
-			stderrWriter.Close()
-		}()
-
-		wg.Wait()
+		err = reader.readMultiplexed(logReader)
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("reading logs: %w", err)
 	}
 
 	// if group, ok := logger.Flush(containerID); ok && group != nil {
 	// 	logger.ProcessLog(containerName, group.Message, enrichedMeta)
 	// }
+	return nil
 }
 
-func readStream(reader io.Reader, containerID, containerName string, logger *processor.LogProcessor, metadata map[string]string) {
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		logMessage := scanner.Text()
-		logger.ProcessLog(containerName, logMessage, metadata)
+func (cc *DockerCollector) loadCheckpoint(containerID string) (time.Time, bool) {
+	val, ok := cc.checkpoints.Get(containerID)
+	if !ok {
+		return time.Time{}, false
 	}
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		log.Printf("Error reading logs for container %s: %v", containerID, err)
+	ts, err := time.Parse(time.RFC3339Nano, val)
+	if err != nil {
+		log.Printf("[WARNING] Ignoring invalid checkpoint for container %s: %q", containerID, val)
+		return time.Time{}, false
 	}
+	return ts, true
 }
 
-func (cc *DockerCollector) removeLogTracker(containerID string) {
-	cc.mu.Lock()
-	defer cc.mu.Unlock()
-	delete(cc.logTrackers, containerID)
+// advanceCheckpoint only moves forward, since stdout and stderr messages are
+// interleaved and a long partial message may complete after a later one.
+func (cc *DockerCollector) advanceCheckpoint(containerID string, ts time.Time) {
+	cc.checkpointMu.Lock()
+	defer cc.checkpointMu.Unlock()
+
+	if current, ok := cc.loadCheckpoint(containerID); ok && !ts.After(current) {
+		return
+	}
+	cc.checkpoints.Set(containerID, ts.Format(time.RFC3339Nano))
 }
@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"log-agent/internal/config"
+)
+
+// newDockerClient connects to endpoint, a Docker host URL such as
+// unix:///run/podman/podman.sock or tcp://10.0.0.5:2376. TCP endpoints use
+// TLS with the configured certificate directory or, like the Docker CLI,
+// with DOCKER_CERT_PATH and DOCKER_TLS_VERIFY.
+func newDockerClient(endpoint string, cfg config.Config) (*client.Client, error) {
+	var opts []client.Opt
+	if strings.HasPrefix(endpoint, "tcp://") {
+		if cfg.DockerCertPath != "" {
+			opts = append(opts, client.WithTLSClientConfig(
+				filepath.Join(cfg.DockerCertPath, "ca.pem"),
+				filepath.Join(cfg.DockerCertPath, "cert.pem"),
+				filepath.Join(cfg.DockerCertPath, "key.pem"),
+			))
+		} else {
+			opts = append(opts, client.WithTLSClientConfigFromEnv())
+		}
+	}
+	opts = append(opts, client.WithHost(endpoint), client.WithVersionFromEnv(), client.WithAPIVersionNegotiation())
+
+	return client.NewClientWithOpts(opts...)
+}
+
+// engineHostName identifies the daemon an entry came from: the remote
+// address for TCP endpoints, this host's name for local sockets.
+func engineHostName(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Scheme == "tcp" {
+		return u.Host
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func checkpointFileName(endpoint string) string {
+	return "docker-checkpoints-" + unsafeFileChars.ReplaceAllString(endpoint, "_") + ".json"
+}
@@ -0,0 +1,199 @@
+package docker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/utils"
+)
+
+// fakeDockerAPI answers the calls the collector makes when listing
+// containers and records which paths were requested.
+type fakeDockerAPI struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (f *fakeDockerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.paths = append(f.paths, r.URL.Path)
+	f.mu.Unlock()
+
+	w.Header().Set("Api-Version", "1.43")
+	switch {
+	case r.URL.Path == "/_ping":
+		w.Write([]byte("OK"))
+	case strings.HasSuffix(r.URL.Path, "/containers/json"):
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeDockerAPI) requested(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.paths {
+		if strings.HasSuffix(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestCollector(t *testing.T, endpoint string) *DockerCollector {
+	t.Helper()
+	cfg := config.Config{StateDir: t.TempDir()}
+	cc := NewContainerCollector(nil, cfg, utils.NewContainerRegistry(), endpoint, false)
+	t.Cleanup(func() {
+		cc.cancel()
+		cc.client.Close()
+		cc.checkpoints.Close()
+	})
+	return cc
+}
+
+func listContainers(t *testing.T, cc *DockerCollector) {
+	t.Helper()
+	cc.collectContainers()
+	if _, err := cc.client.Ping(context.Background()); err != nil {
+		t.Fatalf("ping %s: %v", cc.client.DaemonHost(), err)
+	}
+}
+
+func TestCollectorTalksToUnixSocketEndpoint(t *testing.T) {
+	api := &fakeDockerAPI{}
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &httptest.Server{Listener: l, Config: &http.Server{Handler: api}}
+	srv.Start()
+	defer srv.Close()
+
+	cc := newTestCollector(t, "unix://"+socket)
+	listContainers(t, cc)
+
+	if !api.requested("/containers/json") {
+		t.Errorf("the container list was not requested from %s", socket)
+	}
+	hostname, _ := os.Hostname()
+	if got := cc.hostInfo["engine_host"]; got != hostname {
+		t.Errorf("engine_host = %q, want this host's name %q", got, hostname)
+	}
+}
+
+func TestCollectorTalksToTCPEndpoint(t *testing.T) {
+	api := &fakeDockerAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	cc := newTestCollector(t, "tcp://"+addr)
+	listContainers(t, cc)
+
+	if !api.requested("/containers/json") {
+		t.Errorf("the container list was not requested from %s", addr)
+	}
+	if got := cc.hostInfo["engine_host"]; got != addr {
+		t.Errorf("engine_host = %q, want the remote address %q", got, addr)
+	}
+}
+
+// writeDockerCerts writes ca.pem, cert.pem and key.pem to dir the way
+// DOCKER_CERT_PATH expects them, using one self-signed certificate for
+// 127.0.0.1 as the CA, the server and the client certificate.
+func writeDockerCerts(t *testing.T, dir string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "docker-test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	files := map[string][]byte{
+		"ca.pem":   certPEM,
+		"cert.pem": certPEM,
+		"key.pem":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCollectorUsesDockerTLSEnvironment(t *testing.T) {
+	certDir := t.TempDir()
+	cert := writeDockerCerts(t, certDir)
+	t.Setenv("DOCKER_CERT_PATH", certDir)
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+
+	api := &fakeDockerAPI{}
+	srv := httptest.NewUnstartedServer(api)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	cc := newTestCollector(t, "tcp://"+addr)
+	listContainers(t, cc)
+
+	if !api.requested("/containers/json") {
+		t.Errorf("the container list was not requested over TLS from %s", addr)
+	}
+}
+
+func TestCheckpointFileNamePerEndpoint(t *testing.T) {
+	local := checkpointFileName("unix:///var/run/docker.sock")
+	podman := checkpointFileName("unix:///run/podman/podman.sock")
+	remote := checkpointFileName("tcp://10.0.0.5:2376")
+
+	if local == podman || local == remote || podman == remote {
+		t.Errorf("endpoints share checkpoint files: %q, %q, %q", local, podman, remote)
+	}
+	for _, name := range []string{local, podman, remote} {
+		if strings.ContainsAny(name, "/:") {
+			t.Errorf("checkpoint file name %q is not a plain file name", name)
+		}
+	}
+}
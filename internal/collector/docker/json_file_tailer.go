@@ -0,0 +1,336 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+const (
+	dockerModeAPI  = "api"
+	dockerModeFile = "file"
+
+	filePollInterval     = 500 * time.Millisecond
+	fileLivenessInterval = 5 * time.Second
+	maxRotatedFiles      = 100
+)
+
+// jsonFileRecord is one line of a json-file driver log file.
+type jsonFileRecord struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// fileCheckpoint identifies a read position that survives rotation: the
+// inode of the file being read and the offset of the last complete record.
+type fileCheckpoint struct {
+	inode  uint64
+	offset int64
+}
+
+func (fc fileCheckpoint) String() string {
+	return fmt.Sprintf("%d:%d", fc.inode, fc.offset)
+}
+
+func parseFileCheckpoint(val string) (fileCheckpoint, bool) {
+	inode, offset, found := strings.Cut(val, ":")
+	if !found {
+		return fileCheckpoint{}, false
+	}
+	ino, err1 := strconv.ParseUint(inode, 10, 64)
+	off, err2 := strconv.ParseInt(offset, 10, 64)
+	if err1 != nil || err2 != nil {
+		return fileCheckpoint{}, false
+	}
+	return fileCheckpoint{inode: ino, offset: off}, true
+}
+
+func fileCheckpointKey(containerID string) string {
+	return "file:" + containerID
+}
+
+// jsonFileLogPath maps the log path reported by the daemon onto the
+// configured Docker data root, for agents that see it under a mount point.
+func (cc *DockerCollector) jsonFileLogPath(containerID, logPath string) string {
+	if cc.cfg.DockerDataRoot == "" && logPath != "" {
+		return logPath
+	}
+	root := cc.cfg.DockerDataRoot
+	if root == "" {
+		root = "/var/lib/docker"
+	}
+	return filepath.Join(root, "containers", containerID, containerID+"-json.log")
+}
+
+// tailJSONFile reads a json-file driver log straight from disk, following
+// Docker's rotation (`-json.log` is renamed to `-json.log.1` and so on) and
+// checkpointing the read offset. It returns once the container has stopped
+// and its file has been read to the end.
+func (cc *DockerCollector) tailJSONFile(ctx context.Context, containerID, logPath string, mr *messageReader) error {
+	files, start := cc.resumeFiles(containerID, logPath)
+
+	for i, path := range files {
+		offset := int64(0)
+		if i == 0 {
+			offset = start
+		}
+		follow := i == len(files)-1
+		if err := cc.readJSONFile(ctx, containerID, path, offset, follow, mr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeFiles lists the files to read, oldest first, starting with the file
+// the checkpoint points at. Without a checkpoint only the current file is
+// read, from where the initial tail says: its end for "0", the start of its
+// last N records for a number N, and the start otherwise.
+func (cc *DockerCollector) resumeFiles(containerID, logPath string) ([]string, int64) {
+	if val, ok := cc.checkpoints.Get(fileCheckpointKey(containerID)); ok {
+		if cp, ok := parseFileCheckpoint(val); ok {
+			rotated := []string{logPath}
+			for n := 1; n <= maxRotatedFiles; n++ {
+				path := fmt.Sprintf("%s.%d", logPath, n)
+				if _, err := os.Stat(path); err != nil {
+					break
+				}
+				rotated = append(rotated, path)
+			}
+			for i, path := range rotated {
+				if inode, _, err := statFile(path); err == nil && inode == cp.inode {
+					files := make([]string, 0, i+1)
+					for j := i; j >= 0; j-- {
+						files = append(files, rotated[j])
+					}
+					return files, cp.offset
+				}
+			}
+			log.Printf("[WARNING] Checkpointed log file for container %s was rotated away, resuming from the current file.", containerID)
+			return []string{logPath}, 0
+		}
+	}
+
+	if lines, err := strconv.Atoi(cc.cfg.DockerInitialTail); err == nil {
+		offset, err := tailOffset(logPath, lines)
+		if err != nil {
+			log.Printf("[WARNING] Failed to find the last %d lines of %s, reading it from the start: %v", lines, logPath, err)
+		}
+		return []string{logPath}, offset
+	}
+	return []string{logPath}, 0
+}
+
+// tailOffset returns the offset at which the last n lines of path begin, or 0
+// if it has fewer.
+func tailOffset(path string, n int) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := fi.Size()
+	if n <= 0 {
+		return end, nil
+	}
+
+	buf := make([]byte, 64*1024)
+	newlines := 0
+	for pos := end; pos > 0; {
+		size := min(int64(len(buf)), pos)
+		pos -= size
+		if _, err := file.ReadAt(buf[:size], pos); err != nil {
+			return 0, err
+		}
+		for i := size - 1; i >= 0; i-- {
+			// The newline ending the last line doesn't start another one.
+			if buf[i] != '\n' || pos+i == end-1 {
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+func (cc *DockerCollector) readJSONFile(ctx context.Context, containerID, path string, offset int64, follow bool, mr *messageReader) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	defer func() { file.Close() }()
+
+	inode, size, err := statFile(path)
+	if err != nil {
+		return fmt.Errorf("reading log file: %w", err)
+	}
+	if offset > size {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking log file: %w", err)
+	}
+
+	pending := map[string]*pendingMessage{
+		"stdout": {},
+		"stderr": {},
+	}
+	defer func() {
+		for _, p := range pending {
+			mr.flush(p)
+		}
+	}()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var partial []byte
+	rotated := false
+	lastLiveness := time.Now()
+
+	for {
+		chunk, readErr := reader.ReadSlice('\n')
+		partial = append(partial, chunk...)
+
+		if readErr == nil {
+			offset += int64(len(partial))
+			cc.handleJSONRecord(containerID, partial, fileCheckpoint{inode: inode, offset: offset}, pending, mr)
+			partial = partial[:0]
+			if mr.failed.Load() {
+				return errNotDelivered
+			}
+			continue
+		}
+		if errors.Is(readErr, bufio.ErrBufferFull) {
+			continue
+		}
+		if !errors.Is(readErr, io.EOF) {
+			return fmt.Errorf("reading log file: %w", readErr)
+		}
+		if mr.failed.Load() {
+			return errNotDelivered
+		}
+
+		// At the end of the file: rotated files are done, the current one is
+		// followed until it is rotated away or the container stops.
+		if !follow {
+			return nil
+		}
+
+		currentInode, currentSize, statErr := statFile(path)
+		switch {
+		case statErr == nil && currentInode != inode && !rotated:
+			// Drain what was written to the old file before it was renamed.
+			rotated = true
+			continue
+		case statErr == nil && currentInode != inode:
+			file.Close()
+			if file, err = os.Open(path); err != nil {
+				return fmt.Errorf("opening rotated log file: %w", err)
+			}
+			inode, offset, partial, rotated = currentInode, 0, partial[:0], false
+			reader.Reset(file)
+			continue
+		case statErr == nil && currentSize < offset:
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("seeking log file: %w", err)
+			}
+			offset, partial = 0, partial[:0]
+			reader.Reset(file)
+			continue
+		}
+
+		if time.Since(lastLiveness) >= fileLivenessInterval {
+			lastLiveness = time.Now()
+			if !cc.isRunning(ctx, containerID) {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(filePollInterval):
+		}
+	}
+}
+
+// handleJSONRecord adds one record to its stream's message. end is the
+// position after the record, checkpointed once the message is delivered.
+func (cc *DockerCollector) handleJSONRecord(containerID string, line []byte, end fileCheckpoint, pending map[string]*pendingMessage, mr *messageReader) {
+	var record jsonFileRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		log.Printf("[WARNING] Skipping malformed log record for container %s: %v", containerID, err)
+		return
+	}
+	p, ok := pending[record.Stream]
+	if !ok {
+		return
+	}
+	if !p.started {
+		p.start = fileCheckpoint{inode: end.inode, offset: end.offset - int64(len(line))}
+	}
+	// Resuming past the start of a message the other stream is still
+	// assembling would cut it in half.
+	p.pos = end
+	for _, other := range pending {
+		if other != p && other.started && other.start.offset < p.pos.offset {
+			p.pos = other.start
+		}
+	}
+	mr.appendFragment(p, record.Time, []byte(record.Log))
+}
+
+// advanceFileCheckpoint moves the file checkpoint to a delivered message's
+// pos. Within a file it only moves forward.
+func (cc *DockerCollector) advanceFileCheckpoint(containerID string, pos fileCheckpoint) {
+	cc.checkpointMu.Lock()
+	defer cc.checkpointMu.Unlock()
+
+	key := fileCheckpointKey(containerID)
+	if val, ok := cc.checkpoints.Get(key); ok {
+		if current, ok := parseFileCheckpoint(val); ok && current.inode == pos.inode && current.offset >= pos.offset {
+			return
+		}
+	}
+	cc.checkpoints.Set(key, pos.String())
+}
+
+func (cc *DockerCollector) isRunning(ctx context.Context, containerID string) bool {
+	inspect, err := cc.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return ctx.Err() == nil && !client.IsErrNotFound(err)
+	}
+	return inspect.State != nil && inspect.State.Running
+}
+
+func statFile(path string) (uint64, int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fi.Size(), nil
+	}
+	return st.Ino, fi.Size(), nil
+}
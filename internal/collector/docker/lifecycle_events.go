@@ -0,0 +1,151 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	dockerevents "github.com/docker/docker/api/types/events"
+
+	"log-agent/internal/pipeline"
+)
+
+// Attributes Docker adds to container events next to the container labels.
+var eventAttributes = map[string]bool{
+	"name":     true,
+	"image":    true,
+	"exitCode": true,
+	"signal":   true,
+}
+
+// lifecycleEventQueueSize bounds the events waiting to be shipped, so a slow
+// destination doesn't stall the Docker event loop.
+const lifecycleEventQueueSize = 1000
+
+// queueLifecycleEvent hands an event to shipLifecycleEvents without blocking
+// the Docker event loop.
+func (cc *DockerCollector) queueLifecycleEvent(event dockerevents.Message) {
+	select {
+	case cc.lifecycleEvents <- event:
+	default:
+		log.Printf("[WARNING] Dropping %s event for container %s: queue is full", event.Action, event.Actor.Attributes["name"])
+	}
+}
+
+// shipLifecycleEvents ships queued events in order, which the OOM tracking
+// relies on: an oom event is recorded before the die event that reports it.
+func (cc *DockerCollector) shipLifecycleEvents() {
+	for {
+		select {
+		case <-cc.ctx.Done():
+			return
+		case event := <-cc.lifecycleEvents:
+			cc.emitLifecycleEvent(event)
+			if event.Action == dockerevents.ActionDestroy {
+				cc.oomKilled.Delete(event.Actor.ID)
+			}
+		}
+	}
+}
+
+// emitLifecycleEvent ships container lifecycle events through the pipeline,
+// so they show up next to the container's own logs.
+func (cc *DockerCollector) emitLifecycleEvent(event dockerevents.Message) {
+	action := string(event.Action)
+	attributes := event.Actor.Attributes
+	containerID := event.Actor.ID
+	containerName := attributes["name"]
+
+	if cc.shouldIgnore(containerName, attributes["image"], attributes) {
+		return
+	}
+
+	metadata := make(map[string]string, len(cc.hostInfo)+8)
+	for k, v := range cc.hostInfo {
+		metadata[k] = v
+	}
+	metadata["container_id"] = containerID
+	metadata["container_name"] = containerName
+	metadata["image_name"] = attributes["image"]
+	metadata["event_type"] = "container_lifecycle"
+	metadata["event"] = action
+
+	labels := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		if !eventAttributes[k] {
+			labels[k] = v
+		}
+	}
+	AddLabelMetadata(metadata, labels, cc.cfg.DockerRawLabels)
+
+	level := "INFO"
+	var message string
+
+	switch {
+	case event.Action == dockerevents.ActionDie:
+		exitCode := attributes["exitCode"]
+		oomKilled := cc.wasOOMKilled(containerID)
+		metadata["exit_code"] = exitCode
+		metadata["oom_killed"] = fmt.Sprint(oomKilled)
+
+		message = fmt.Sprintf("Container %s died with exit code %s", containerName, exitCode)
+		if oomKilled {
+			message += " (OOM killed)"
+		}
+		if exitCode != "0" || oomKilled {
+			level = "ERROR"
+		}
+	case event.Action == dockerevents.ActionOOM:
+		cc.oomKilled.Store(containerID, true)
+		metadata["oom_killed"] = "true"
+		message = fmt.Sprintf("Container %s ran out of memory", containerName)
+		level = "ERROR"
+	case event.Action == dockerevents.ActionKill:
+		metadata["signal"] = attributes["signal"]
+		message = fmt.Sprintf("Container %s was sent signal %s", containerName, attributes["signal"])
+		level = "WARN"
+	case strings.HasPrefix(action, string(dockerevents.ActionHealthStatus)):
+		status := strings.TrimSpace(strings.TrimPrefix(action, string(dockerevents.ActionHealthStatus)+":"))
+		metadata["event"] = string(dockerevents.ActionHealthStatus)
+		metadata["health_status"] = status
+		message = fmt.Sprintf("Container %s is %s", containerName, status)
+		if event.Action == dockerevents.ActionHealthStatusUnhealthy {
+			level = "WARN"
+		}
+	case event.Action == dockerevents.ActionStart:
+		cc.oomKilled.Delete(containerID)
+		message = fmt.Sprintf("Container %s started", containerName)
+	case event.Action == dockerevents.ActionStop:
+		message = fmt.Sprintf("Container %s stopped", containerName)
+	case event.Action == dockerevents.ActionRestart:
+		message = fmt.Sprintf("Container %s restarted", containerName)
+	default:
+		return
+	}
+
+	hints := pipeline.EntryHints{
+		Timestamp: time.Unix(0, event.TimeNano),
+		Level:     level,
+		SkipSplit: true,
+		// A container dying again is a new event, not a duplicate line.
+		SkipDedup: true,
+	}
+	if err := cc.Logger.ProcessLogWithHints(containerName, message, hints, metadata); err != nil {
+		log.Printf("[ERROR] Failed to deliver %s event for container %s: %v", action, containerName, err)
+	}
+}
+
+// wasOOMKilled prefers the daemon's view of the container state and falls back
+// to an oom event seen earlier, e.g. when the container is already removed.
+func (cc *DockerCollector) wasOOMKilled(containerID string) bool {
+	ctx, cancel := context.WithTimeout(cc.ctx, 5*time.Second)
+	defer cancel()
+
+	if inspect, err := cc.client.ContainerInspect(ctx, containerID); err == nil && inspect.State != nil && inspect.State.OOMKilled {
+		return true
+	}
+	_, seen := cc.oomKilled.Load(containerID)
+	return seen
+}
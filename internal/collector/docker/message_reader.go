@@ -0,0 +1,235 @@
+package docker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+)
+
+const (
+	streamStdout    = 1
+	streamStderr    = 2
+	streamSystemErr = 3
+
+	frameHeaderSize = 8
+)
+
+// messageReader turns a Docker log stream into complete log messages. The
+// daemon splits lines longer than 16KB into partial messages that arrive as
+// separate frames without a trailing newline, each with its own timestamp.
+type messageReader struct {
+	cc            *DockerCollector
+	logger        *processor.LogProcessor
+	containerID   string
+	containerName string
+	metadata      map[string]string
+	since         time.Time
+	maxBytes      int
+	options       containerOptions
+	multiline     *multilineAggregator
+	// failed is set once a message could not be delivered. The checkpoints
+	// then stay before it and reading stops, so the stream is re-attached
+	// from the last delivered message. The multiline aggregator emits from
+	// its own timer, hence atomic.
+	failed atomic.Bool
+}
+
+func newMessageReader(cc *DockerCollector, logger *processor.LogProcessor, containerID, containerName string, metadata map[string]string, since time.Time, options containerOptions) *messageReader {
+	mr := &messageReader{
+		cc:            cc,
+		logger:        logger,
+		containerID:   containerID,
+		containerName: containerName,
+		metadata:      metadata,
+		since:         since,
+		maxBytes:      cc.cfg.MaxLineBytes,
+		options:       options,
+	}
+	if options.multiline != nil {
+		mr.multiline = newMultilineAggregator(options.multiline, mr.emit)
+	}
+	return mr
+}
+
+// close delivers whatever the multiline aggregator is still holding.
+func (mr *messageReader) close() {
+	if mr.multiline != nil {
+		mr.multiline.stop()
+	}
+}
+
+// pendingMessage accumulates the partial frames of one message.
+type pendingMessage struct {
+	buf       []byte
+	firstTS   time.Time
+	lastTS    time.Time
+	truncated bool
+	started   bool
+	// In a json-file log, start is where the message's first record begins
+	// and pos where reading can resume once it is delivered. Both are zero
+	// for API streams.
+	start fileCheckpoint
+	pos   fileCheckpoint
+}
+
+func (mr *messageReader) readMultiplexed(reader io.Reader) error {
+	pending := map[byte]*pendingMessage{
+		streamStdout: {},
+		streamStderr: {},
+	}
+	defer func() {
+		for _, p := range pending {
+			mr.flush(p)
+		}
+	}()
+
+	header := make([]byte, frameHeaderSize)
+	var frame []byte
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		size := int(binary.BigEndian.Uint32(header[4:]))
+		if cap(frame) < size {
+			frame = make([]byte, size)
+		}
+		frame = frame[:size]
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return err
+		}
+
+		stream := header[0]
+		if stream == streamSystemErr {
+			return fmt.Errorf("daemon error: %s", frame)
+		}
+		p, ok := pending[stream]
+		if !ok {
+			continue
+		}
+		mr.addFragment(p, frame)
+		if mr.failed.Load() {
+			return errNotDelivered
+		}
+	}
+}
+
+// readRaw handles TTY containers, whose output is not multiplexed and so
+// carries no frame boundaries to reassemble partial messages from.
+func (mr *messageReader) readRaw(reader io.Reader) error {
+	lines := utils.NewLineReader(reader, mr.maxBytes)
+	for {
+		line, truncated, err := lines.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		p := &pendingMessage{truncated: truncated}
+		mr.addFragment(p, []byte(line+"\n"))
+		if mr.failed.Load() {
+			return errNotDelivered
+		}
+	}
+}
+
+func (mr *messageReader) addFragment(p *pendingMessage, fragment []byte) {
+	ts, rest, hasTS := utils.SplitTimestampPrefix(string(fragment))
+	if !hasTS {
+		mr.appendFragment(p, time.Time{}, fragment)
+		return
+	}
+
+	// Since is inclusive, so the fragment the checkpoint points at is sent
+	// again by the daemon.
+	if !mr.since.IsZero() && !ts.After(mr.since) {
+		return
+	}
+	mr.appendFragment(p, ts, []byte(rest))
+}
+
+// appendFragment adds one frame's text to p; a trailing newline completes the
+// message. ts is zero when the fragment carries no timestamp.
+func (mr *messageReader) appendFragment(p *pendingMessage, ts time.Time, fragment []byte) {
+	if !ts.IsZero() {
+		if !p.started {
+			p.firstTS = ts
+		}
+		p.lastTS = ts
+	}
+	p.started = true
+
+	complete := len(fragment) > 0 && fragment[len(fragment)-1] == '\n'
+	if complete {
+		fragment = fragment[:len(fragment)-1]
+	}
+
+	if room := mr.maxBytes - len(p.buf); len(fragment) > room {
+		fragment = fragment[:max(room, 0)]
+		p.truncated = true
+	}
+	p.buf = append(p.buf, fragment...)
+
+	if complete {
+		mr.flush(p)
+	}
+}
+
+func (mr *messageReader) flush(p *pendingMessage) {
+	if !p.started {
+		return
+	}
+	msg := string(p.buf)
+	firstTS, lastTS, truncated, pos := p.firstTS, p.lastTS, p.truncated, p.pos
+	*p = pendingMessage{buf: p.buf[:0]}
+
+	if mr.multiline != nil {
+		mr.multiline.add(msg, firstTS, lastTS, truncated, pos)
+		return
+	}
+	mr.emit(msg, firstTS, lastTS, truncated, pos)
+}
+
+// emit delivers a complete message and, only once it and every message before
+// it were delivered, moves the checkpoints past it.
+func (mr *messageReader) emit(msg string, firstTS, lastTS time.Time, truncated bool, pos fileCheckpoint) {
+	metadata := mr.metadata
+	if truncated {
+		metadata = make(map[string]string, len(mr.metadata)+1)
+		for k, v := range mr.metadata {
+			metadata[k] = v
+		}
+		metadata["truncated"] = "true"
+	}
+
+	hints := pipeline.EntryHints{
+		Timestamp: firstTS,
+		SkipSplit: mr.multiline != nil,
+	}
+	if err := mr.options.process(mr.logger, mr.containerName, msg, hints, metadata); err != nil {
+		mr.failed.Store(true)
+		return
+	}
+	if mr.failed.Load() {
+		return
+	}
+	if !lastTS.IsZero() {
+		mr.cc.advanceCheckpoint(mr.containerID, lastTS)
+	}
+	if pos.inode != 0 {
+		mr.cc.advanceFileCheckpoint(mr.containerID, pos)
+	}
+}
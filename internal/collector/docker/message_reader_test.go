@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+)
+
+func TestMessageReaderStopsAfterDeliveryFailure(t *testing.T) {
+	var delivered []string
+	p := pipeline.NewPipeline(
+		func(raw string) []string { return []string{raw} },
+		func(line string) string { return line },
+		func(string) bool { return true },
+		func(line string) string { return line },
+		func(string) string { return "" },
+		func(string) (time.Time, bool) { return time.Time{}, false },
+		func(string) string { return "" },
+		func(entry *pipeline.LogEntry) error {
+			if entry.Message == "two" {
+				return errors.New("output unavailable")
+			}
+			delivered = append(delivered, entry.Message)
+			return nil
+		},
+	)
+	cc := &DockerCollector{
+		cfg:         config.Config{MaxLineBytes: 1024},
+		checkpoints: utils.NewCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"), time.Hour),
+	}
+	mr := newMessageReader(cc, processor.NewLogProcessor(p), "abc", "app", nil, time.Time{}, containerOptions{})
+
+	stream := strings.Join([]string{
+		"2024-01-01T00:00:01.000000000Z one",
+		"2024-01-01T00:00:02.000000000Z two",
+		"2024-01-01T00:00:03.000000000Z three",
+	}, "\n") + "\n"
+	if err := mr.readRaw(strings.NewReader(stream)); !errors.Is(err, errNotDelivered) {
+		t.Fatalf("readRaw() error = %v, want %v", err, errNotDelivered)
+	}
+
+	if strings.Join(delivered, ",") != "one" {
+		t.Errorf("delivered %q, want only the message before the failure", delivered)
+	}
+	want := time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC)
+	if ts, ok := cc.loadCheckpoint("abc"); !ok || !ts.Equal(want) {
+		t.Errorf("checkpoint = %v, want %v", ts, want)
+	}
+}
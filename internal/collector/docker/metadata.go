@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+)
+
+// Well-known labels set by Docker Compose and Swarm, promoted to first-class
+// entry labels.
+var orchestratorLabels = map[string]string{
+	"com.docker.compose.project":          "compose_project",
+	"com.docker.compose.service":          "compose_service",
+	"com.docker.compose.container-number": "compose_container_number",
+	"com.docker.swarm.service.name":       "swarm_service",
+	"com.docker.swarm.service.id":         "swarm_service_id",
+	"com.docker.swarm.task.name":          "swarm_task",
+	"com.docker.swarm.task.id":            "swarm_task_id",
+	"com.docker.swarm.node.id":            "swarm_node_id",
+}
+
+func (cc *DockerCollector) containerMetadata(ctx context.Context, containerJSON container.InspectResponse, containerID, containerName string) map[string]string {
+	metadata := make(map[string]string, len(cc.hostInfo)+8)
+	for k, v := range cc.hostInfo {
+		metadata[k] = v
+	}
+
+	metadata["container_id"] = containerID
+	metadata["container_name"] = containerName
+
+	for k, v := range cc.imageMetadata(ctx, containerJSON.Config.Image, containerJSON.Image) {
+		metadata[k] = v
+	}
+
+	AddLabelMetadata(metadata, containerJSON.Config.Labels, cc.cfg.DockerRawLabels)
+
+	return metadata
+}
+
+// AddLabelMetadata promotes Compose and Swarm labels to entry labels and, if
+// includeRaw is set, copies every container label as `label_<key>`.
+func AddLabelMetadata(metadata, labels map[string]string, includeRaw bool) {
+	for k, v := range labels {
+		if name, ok := orchestratorLabels[k]; ok {
+			metadata[name] = v
+		}
+		if includeRaw {
+			metadata[fmt.Sprintf("label_%s", k)] = v
+		}
+	}
+}
+
+// imageMetadata splits the image reference the container was created from
+// into name and tag, and resolves the repository digest of the image.
+func (cc *DockerCollector) imageMetadata(ctx context.Context, imageRef, imageID string) map[string]string {
+	metadata := map[string]string{
+		"image_name": imageRef,
+		"image_id":   imageID,
+	}
+
+	named, err := reference.ParseNormalizedNamed(imageRef)
+	if err == nil {
+		metadata["image_name"] = reference.FamiliarName(named)
+		if tagged, ok := named.(reference.Tagged); ok {
+			metadata["image_tag"] = tagged.Tag()
+		} else if _, digested := named.(reference.Digested); !digested {
+			metadata["image_tag"] = "latest"
+		}
+		if digested, ok := named.(reference.Digested); ok {
+			metadata["image_digest"] = digested.Digest().String()
+		}
+	}
+
+	if _, ok := metadata["image_digest"]; !ok {
+		if digest := cc.repoDigest(ctx, imageID, named); digest != "" {
+			metadata["image_digest"] = digest
+		}
+	}
+
+	return metadata
+}
+
+func (cc *DockerCollector) repoDigest(ctx context.Context, imageID string, named reference.Named) string {
+	if cached, ok := cc.imageDigests.Load(imageID); ok {
+		return cached.(string)
+	}
+
+	inspect, err := cc.client.ImageInspect(ctx, imageID)
+	if err != nil {
+		return ""
+	}
+
+	var digest string
+	for _, repoDigest := range inspect.RepoDigests {
+		name, d, found := strings.Cut(repoDigest, "@")
+		if !found {
+			continue
+		}
+		if digest == "" || (named != nil && name == named.Name()) {
+			digest = d
+		}
+	}
+
+	cc.imageDigests.Store(imageID, digest)
+	return digest
+}
@@ -0,0 +1,94 @@
+package dockerplugin
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker/api/types/plugins/logdriver"
+)
+
+// entryStore keeps a bounded local copy of a container's log entries in the
+// daemon's own wire format, so ReadLogs (`docker logs`) can replay them. Once
+// the file exceeds maxBytes it is rotated to `<path>.1`.
+type entryStore struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	encoder  logdriver.LogEntryEncoder
+	size     int64
+	maxBytes int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+func openEntryStore(path string, maxBytes int64) (*entryStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &entryStore{path: path, maxBytes: maxBytes}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *entryStore) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = fi.Size()
+	s.encoder = logdriver.NewLogEntryEncoder(countingWriter{w: file, n: &s.size})
+	return nil
+}
+
+func (s *entryStore) write(entry *logdriver.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("entry store is closed")
+	}
+	if s.size >= s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	return s.encoder.Encode(entry)
+}
+
+func (s *entryStore) rotate() error {
+	s.file.Close()
+	s.file = nil
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *entryStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
@@ -0,0 +1,216 @@
+package dockerplugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types/plugins/logdriver"
+
+	"log-agent/internal/processor"
+)
+
+// drainIdleTimeout is how long a stopping stream waits for more buffered
+// entries before it finishes.
+const drainIdleTimeout = 50 * time.Millisecond
+
+// logStream consumes the FIFO the daemon writes one container's log entries
+// to, as length-prefixed protobuf LogEntry messages.
+type logStream struct {
+	file          string
+	containerID   string
+	containerName string
+	metadata      map[string]string
+	logger        *processor.LogProcessor
+	store         *entryStore
+	maxBytes      int
+
+	mu       sync.Mutex
+	fifo     *os.File
+	closing  bool
+	draining atomic.Bool
+	done     chan struct{}
+}
+
+// drainReader gives every read a short deadline once the stream is stopping,
+// so reading ends as soon as the FIFO holds nothing more.
+type drainReader struct {
+	s    *logStream
+	fifo *os.File
+}
+
+func (r drainReader) Read(p []byte) (int, error) {
+	if r.s.draining.Load() {
+		r.fifo.SetReadDeadline(time.Now().Add(drainIdleTimeout))
+	}
+	return r.fifo.Read(p)
+}
+
+// pendingLine accumulates the partial entries the daemon splits long lines into.
+type pendingLine struct {
+	buf       []byte
+	ts        time.Time
+	truncated bool
+}
+
+func newLogStream(lp *LogDriverPlugin, file string, info containerInfo) (*logStream, error) {
+	if fi, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("opening log fifo: %w", err)
+	} else if fi.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("opening log fifo: %s is not a fifo", file)
+	}
+
+	s := &logStream{
+		file:          file,
+		containerID:   info.ContainerID,
+		containerName: strings.TrimPrefix(info.ContainerName, "/"),
+		metadata:      lp.metadata(info),
+		logger:        lp.Logger,
+		maxBytes:      lp.cfg.MaxLineBytes,
+		done:          make(chan struct{}),
+	}
+
+	if lp.cfg.PluginStoreBytes > 0 {
+		store, err := openEntryStore(lp.storePath(info.ContainerID), lp.cfg.PluginStoreBytes)
+		if err != nil {
+			log.Printf("[WARNING] ReadLogs disabled for container %s: %v", s.containerName, err)
+		} else {
+			s.store = store
+		}
+	}
+
+	return s, nil
+}
+
+func (s *logStream) run() {
+	defer close(s.done)
+	if s.store != nil {
+		defer s.store.close()
+	}
+
+	// Blocks until the daemon opens the write side of the FIFO.
+	fifo, err := os.OpenFile(s.file, os.O_RDONLY, 0)
+	if err != nil {
+		log.Printf("[ERROR] Failed to open log fifo for container %s: %v", s.containerName, err)
+		return
+	}
+	defer fifo.Close()
+
+	s.mu.Lock()
+	s.fifo = fifo
+	closing := s.closing
+	s.mu.Unlock()
+	if closing {
+		return
+	}
+
+	pending := map[string]*pendingLine{}
+	decoder := logdriver.NewLogEntryDecoder(drainReader{s: s, fifo: fifo})
+
+	var entry logdriver.LogEntry
+	for {
+		entry.Reset()
+		if err := decoder.Decode(&entry); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) && !errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("[ERROR] Error reading log entries for container %s: %v", s.containerName, err)
+			}
+			break
+		}
+
+		if s.store != nil {
+			if err := s.store.write(&entry); err != nil {
+				log.Printf("[ERROR] Failed to store log entry for container %s: %v", s.containerName, err)
+			}
+		}
+
+		p, ok := pending[entry.Source]
+		if !ok {
+			p = &pendingLine{}
+			pending[entry.Source] = p
+		}
+		s.add(p, &entry)
+	}
+
+	for _, p := range pending {
+		if len(p.buf) > 0 {
+			s.flush(p)
+		}
+	}
+}
+
+func (s *logStream) add(p *pendingLine, entry *logdriver.LogEntry) {
+	if len(p.buf) == 0 && !p.truncated {
+		p.ts = time.Unix(0, entry.TimeNano)
+	}
+
+	line := entry.Line
+	if room := s.maxBytes - len(p.buf); len(line) > room {
+		line = line[:max(room, 0)]
+		p.truncated = true
+	}
+	p.buf = append(p.buf, line...)
+
+	last := !entry.Partial || (entry.PartialLogMetadata != nil && entry.PartialLogMetadata.Last)
+	if last {
+		s.flush(p)
+	}
+}
+
+func (s *logStream) flush(p *pendingLine) {
+	metadata := s.metadata
+	if p.truncated {
+		metadata = make(map[string]string, len(s.metadata)+1)
+		for k, v := range s.metadata {
+			metadata[k] = v
+		}
+		metadata["truncated"] = "true"
+	}
+
+	s.logger.ProcessLogAt(s.containerName, string(p.buf), p.ts, metadata)
+
+	p.buf = p.buf[:0]
+	p.truncated = false
+}
+
+// stop finishes the stream after reading what is already buffered in the
+// FIFO. The daemon only closes its end after StopLogging returns, so waiting
+// for EOF would hold up every container stop. timeout bounds the drain for
+// a container that keeps writing.
+func (s *logStream) stop(timeout time.Duration) {
+	s.draining.Store(true)
+	s.mu.Lock()
+	fifo := s.fifo
+	s.mu.Unlock()
+
+	if fifo == nil || fifo.SetReadDeadline(time.Now().Add(drainIdleTimeout)) != nil {
+		s.close()
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		s.close()
+	}
+}
+
+func (s *logStream) close() {
+	s.mu.Lock()
+	s.closing = true
+	fifo := s.fifo
+	s.mu.Unlock()
+
+	if fifo != nil {
+		fifo.Close()
+	} else if w, err := os.OpenFile(s.file, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		// Unblocks the pending open in run when the daemon never connected.
+		w.Close()
+	}
+	<-s.done
+}
@@ -0,0 +1,262 @@
+package dockerplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"log-agent/internal/collector/docker"
+	"log-agent/internal/config"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+const pluginContentType = "application/vnd.docker.plugins.v1+json"
+
+// containerInfo is the subset of the daemon's logger.Info sent with
+// StartLogging and ReadLogs that the agent uses.
+type containerInfo struct {
+	Config             map[string]string `json:"Config"`
+	ContainerID        string            `json:"ContainerID"`
+	ContainerName      string            `json:"ContainerName"`
+	ContainerImageID   string            `json:"ContainerImageID"`
+	ContainerImageName string            `json:"ContainerImageName"`
+	ContainerLabels    map[string]string `json:"ContainerLabels"`
+}
+
+type startLoggingRequest struct {
+	File string        `json:"File"`
+	Info containerInfo `json:"Info"`
+}
+
+type stopLoggingRequest struct {
+	File string `json:"File"`
+}
+
+type readConfig struct {
+	Since  time.Time `json:"Since"`
+	Until  time.Time `json:"Until"`
+	Tail   int       `json:"Tail"`
+	Follow bool      `json:"Follow"`
+}
+
+type readLogsRequest struct {
+	Info   containerInfo `json:"Info"`
+	Config readConfig    `json:"Config"`
+}
+
+type pluginResponse struct {
+	Err string `json:"Err"`
+}
+
+// LogDriverPlugin implements Docker's logging driver plugin protocol, so the
+// daemon pushes container output to the agent as it is written instead of
+// the agent streaming it through the API.
+type LogDriverPlugin struct {
+	Logger   *processor.LogProcessor
+	cfg      config.Config
+	hostInfo map[string]string
+	server   *http.Server
+
+	mu      sync.Mutex
+	streams map[string]*logStream
+}
+
+func NewLogDriverPlugin(logger *processor.LogProcessor, cfg config.Config) *LogDriverPlugin {
+	lp := &LogDriverPlugin{
+		Logger:   logger,
+		cfg:      cfg,
+		hostInfo: utils.GetHostMetadata(),
+		streams:  make(map[string]*logStream),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", lp.handleActivate)
+	mux.HandleFunc("/LogDriver.StartLogging", lp.handleStartLogging)
+	mux.HandleFunc("/LogDriver.StopLogging", lp.handleStopLogging)
+	mux.HandleFunc("/LogDriver.Capabilities", lp.handleCapabilities)
+	mux.HandleFunc("/LogDriver.ReadLogs", lp.handleReadLogs)
+	lp.server = &http.Server{Handler: mux}
+
+	return lp
+}
+
+func (lp *LogDriverPlugin) Start() {
+	socket := lp.cfg.PluginSocket
+	if err := os.MkdirAll(filepath.Dir(socket), 0o755); err != nil {
+		log.Fatalf("[ERROR] Failed to create plugin socket directory: %v", err)
+	}
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to listen on plugin socket %s: %v", socket, err)
+	}
+
+	log.Printf("[INFO] Docker log driver plugin listening on %s", socket)
+	go lp.pruneOrphanedStores()
+	if err := lp.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("[ERROR] Log driver plugin server stopped: %v", err)
+	}
+}
+
+func (lp *LogDriverPlugin) Stop() {
+	log.Println("[WARNING] Stopping Docker log driver plugin...")
+	lp.server.Close()
+
+	lp.mu.Lock()
+	streams := make([]*logStream, 0, len(lp.streams))
+	for _, s := range lp.streams {
+		streams = append(streams, s)
+	}
+	lp.mu.Unlock()
+
+	for _, s := range streams {
+		s.close()
+	}
+}
+
+func (lp *LogDriverPlugin) handleActivate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string][]string{"Implements": {"LoggingDriver"}})
+}
+
+func (lp *LogDriverPlugin) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]map[string]bool{"Cap": {"ReadLogs": lp.cfg.PluginStoreBytes > 0}})
+}
+
+func (lp *LogDriverPlugin) handleStartLogging(w http.ResponseWriter, r *http.Request) {
+	var req startLoggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, pluginResponse{Err: err.Error()})
+		return
+	}
+	if req.Info.ContainerID == "" {
+		writeJSON(w, pluginResponse{Err: "missing container id"})
+		return
+	}
+
+	stream, err := newLogStream(lp, req.File, req.Info)
+	if err != nil {
+		writeJSON(w, pluginResponse{Err: err.Error()})
+		return
+	}
+
+	lp.mu.Lock()
+	lp.streams[req.File] = stream
+	lp.mu.Unlock()
+
+	log.Printf("[INFO] Started logging for container %s", stream.containerName)
+	go stream.run()
+
+	writeJSON(w, pluginResponse{})
+}
+
+func (lp *LogDriverPlugin) handleStopLogging(w http.ResponseWriter, r *http.Request) {
+	var req stopLoggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, pluginResponse{Err: err.Error()})
+		return
+	}
+
+	lp.mu.Lock()
+	stream, ok := lp.streams[req.File]
+	delete(lp.streams, req.File)
+	lp.mu.Unlock()
+
+	if ok {
+		stream.stop(5 * time.Second)
+		log.Printf("[INFO] Stopped logging for container %s", stream.containerName)
+	}
+
+	writeJSON(w, pluginResponse{})
+}
+
+func (lp *LogDriverPlugin) metadata(info containerInfo) map[string]string {
+	metadata := make(map[string]string, len(lp.hostInfo)+8)
+	for k, v := range lp.hostInfo {
+		metadata[k] = v
+	}
+	metadata["container_id"] = info.ContainerID
+	metadata["container_name"] = strings.TrimPrefix(info.ContainerName, "/")
+	metadata["image_name"] = info.ContainerImageName
+	metadata["image_id"] = info.ContainerImageID
+	docker.AddLabelMetadata(metadata, info.ContainerLabels, lp.cfg.DockerRawLabels)
+	return metadata
+}
+
+func (lp *LogDriverPlugin) storeDir() string {
+	return filepath.Join(lp.cfg.StateDir, "plugin-logs")
+}
+
+func (lp *LogDriverPlugin) storePath(containerID string) string {
+	return filepath.Join(lp.storeDir(), containerID+".log")
+}
+
+// pruneOrphanedStores deletes the local copies of containers that no longer
+// exist. Stores outlive StopLogging so `docker logs` works for exited
+// containers, and the daemon doesn't tell logging plugins when a container
+// is removed, so they are cleaned up when the plugin starts.
+func (lp *LogDriverPlugin) pruneOrphanedStores() {
+	files, err := os.ReadDir(lp.storeDir())
+	if err != nil || len(files) == 0 {
+		return
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Printf("[WARNING] Not pruning stored logs, failed to create Docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	listed := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		log.Printf("[WARNING] Not pruning stored logs, failed to list containers: %v", err)
+		return
+	}
+	exists := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		exists[c.ID] = true
+	}
+
+	removed := 0
+	for _, f := range files {
+		id := strings.TrimSuffix(strings.TrimSuffix(f.Name(), ".1"), ".log")
+		if exists[id] {
+			continue
+		}
+		// A store written since the listing belongs to a new container.
+		if info, err := f.Info(); err != nil || !info.ModTime().Before(listed) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(lp.storeDir(), f.Name())); err != nil {
+			log.Printf("[WARNING] Failed to remove stored logs %s: %v", f.Name(), err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("[INFO] Removed %d stored log files of removed containers.", removed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", pluginContentType)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[ERROR] Failed to write plugin response: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package dockerplugin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/docker/docker/api/types/plugins/logdriver"
+)
+
+const followPollInterval = 500 * time.Millisecond
+
+// handleReadLogs serves `docker logs` from the entries stored by entryStore,
+// answering with the same length-prefixed protobuf stream the daemon writes
+// to the FIFO.
+func (lp *LogDriverPlugin) handleReadLogs(w http.ResponseWriter, r *http.Request) {
+	var req readLogsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if lp.cfg.PluginStoreBytes <= 0 {
+		http.Error(w, "reading logs is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	path := lp.storePath(req.Info.ContainerID)
+	cfg := req.Config
+
+	var entries []*logdriver.LogEntry
+	if _, err := readStoredEntries(path+".1", 0, func(e *logdriver.LogEntry) { entries = append(entries, e) }); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[WARNING] Failed to read rotated log store %s.1: %v", path, err)
+	}
+	offset, err := readStoredEntries(path, 0, func(e *logdriver.LogEntry) { entries = append(entries, e) })
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries = filterEntries(entries, cfg)
+	// A negative Tail means all entries, as with `docker logs` without --tail.
+	if cfg.Tail >= 0 && len(entries) > cfg.Tail {
+		entries = entries[len(entries)-cfg.Tail:]
+	}
+
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	encoder := logdriver.NewLogEntryEncoder(w)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			return
+		}
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	if !cfg.Follow {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(followPollInterval):
+		}
+
+		if fi, err := os.Stat(path); err == nil && fi.Size() < offset {
+			// The store was rotated; continue from the start of the new file.
+			offset = 0
+		}
+
+		var sendErr error
+		stop := false
+		offset, _ = readStoredEntries(path, offset, func(e *logdriver.LogEntry) {
+			if sendErr != nil || stop {
+				return
+			}
+			if !cfg.Until.IsZero() && time.Unix(0, e.TimeNano).After(cfg.Until) {
+				stop = true
+				return
+			}
+			sendErr = encoder.Encode(e)
+		})
+		if sendErr != nil || stop {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+func filterEntries(entries []*logdriver.LogEntry, cfg readConfig) []*logdriver.LogEntry {
+	filtered := entries[:0]
+	for _, e := range entries {
+		ts := time.Unix(0, e.TimeNano)
+		if !cfg.Since.IsZero() && ts.Before(cfg.Since) {
+			continue
+		}
+		if !cfg.Until.IsZero() && ts.After(cfg.Until) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// readStoredEntries decodes complete entries starting at offset and returns
+// the offset just past the last complete one, so a follow loop can resume
+// there once a half-written entry is finished.
+func readStoredEntries(path string, offset int64, fn func(*logdriver.LogEntry)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	var consumed int64
+	reader := countingReader{r: file, n: &consumed}
+	decoder := logdriver.NewLogEntryDecoder(reader)
+
+	for {
+		start := consumed
+		entry := &logdriver.LogEntry{}
+		if err := decoder.Decode(entry); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset + start, nil
+			}
+			return offset + start, err
+		}
+		fn(entry)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	*cr.n += int64(n)
+	return n, err
+}
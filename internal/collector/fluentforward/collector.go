@@ -0,0 +1,229 @@
+package fluentforward
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/fluent"
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const handshakeTimeout = 10 * time.Second
+
+// ForwardCollector accepts the Fluent Forward protocol, as spoken by
+// Docker's fluentd log driver, Fluent Bit and Fluentd, over TCP and a unix
+// socket.
+type ForwardCollector struct {
+	Logger    *processor.LogProcessor
+	cfg       config.Config
+	hostname  string
+	listeners []net.Listener
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	stopping bool
+	wg       sync.WaitGroup
+}
+
+func NewForwardCollector(logger *processor.LogProcessor, cfg config.Config) *ForwardCollector {
+	hostname, _ := os.Hostname()
+	return &ForwardCollector{
+		Logger:   logger,
+		cfg:      cfg,
+		hostname: hostname,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+func (fc *ForwardCollector) Start() {
+	if fc.cfg.ForwardAddr != "" {
+		if l, err := net.Listen("tcp", fc.cfg.ForwardAddr); err != nil {
+			log.Printf("[ERROR] Failed to listen for Forward protocol on %s: %v", fc.cfg.ForwardAddr, err)
+		} else {
+			fc.serve(l)
+		}
+	}
+	if fc.cfg.ForwardSocket != "" {
+		if err := os.MkdirAll(filepath.Dir(fc.cfg.ForwardSocket), 0o755); err != nil {
+			log.Printf("[ERROR] Failed to create Forward socket directory: %v", err)
+		}
+		os.Remove(fc.cfg.ForwardSocket)
+		if l, err := net.Listen("unix", fc.cfg.ForwardSocket); err != nil {
+			log.Printf("[ERROR] Failed to listen for Forward protocol on %s: %v", fc.cfg.ForwardSocket, err)
+		} else {
+			fc.serve(l)
+		}
+	}
+}
+
+func (fc *ForwardCollector) Stop() {
+	log.Println("[WARNING] Stopping Forward input...")
+	fc.mu.Lock()
+	fc.stopping = true
+	for _, l := range fc.listeners {
+		l.Close()
+	}
+	for conn := range fc.conns {
+		conn.Close()
+	}
+	fc.mu.Unlock()
+	fc.wg.Wait()
+}
+
+func (fc *ForwardCollector) serve(l net.Listener) {
+	fc.mu.Lock()
+	if fc.stopping {
+		fc.mu.Unlock()
+		l.Close()
+		return
+	}
+	fc.listeners = append(fc.listeners, l)
+	fc.wg.Add(1)
+	fc.mu.Unlock()
+	log.Printf("[INFO] Forward input listening on %s", l.Addr())
+
+	go func() {
+		defer fc.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("[ERROR] Forward input stopped accepting on %s: %v", l.Addr(), err)
+				}
+				return
+			}
+
+			fc.mu.Lock()
+			if fc.stopping {
+				fc.mu.Unlock()
+				conn.Close()
+				return
+			}
+			fc.conns[conn] = struct{}{}
+			fc.wg.Add(1)
+			fc.mu.Unlock()
+
+			go func() {
+				defer fc.wg.Done()
+				fc.handleConn(conn)
+				fc.mu.Lock()
+				delete(fc.conns, conn)
+				fc.mu.Unlock()
+			}()
+		}
+	}()
+}
+
+func (fc *ForwardCollector) handleConn(conn net.Conn) {
+	defer conn.Close()
+	peer := conn.RemoteAddr().String()
+
+	dec := msgpack.NewDecoder(conn)
+	dec.UseLooseInterfaceDecoding(true)
+	enc := msgpack.NewEncoder(conn)
+
+	if fc.cfg.ForwardSharedKey != "" {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := fc.handshake(dec, enc); err != nil {
+			log.Printf("[WARNING] Forward handshake with %s failed: %v", peer, err)
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	}
+
+	for {
+		v, err := dec.DecodeInterface()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("[WARNING] Closing Forward connection from %s: %v", peer, err)
+			}
+			return
+		}
+		msg, ok := v.([]interface{})
+		if !ok {
+			log.Printf("[WARNING] Closing Forward connection from %s: message is not an array", peer)
+			return
+		}
+
+		fm, err := decodeMessage(msg)
+		if err != nil {
+			log.Printf("[WARNING] Closing Forward connection from %s: %v", peer, err)
+			return
+		}
+
+		if err := fc.ship(fm); err != nil {
+			// Without an ack the sender retransmits the chunk.
+			log.Printf("[ERROR] Failed to deliver Forward chunk from %s: %v", peer, err)
+			continue
+		}
+		if fm.chunk != "" {
+			if err := enc.Encode(map[string]string{"ack": fm.chunk}); err != nil {
+				log.Printf("[WARNING] Failed to ack Forward chunk from %s: %v", peer, err)
+				return
+			}
+		}
+	}
+}
+
+func (fc *ForwardCollector) ship(fm *forwardMessage) error {
+	var firstErr error
+	for _, entry := range fm.entries {
+		message, labels := entryFields(fm.tag, entry.record)
+		if message == "" {
+			continue
+		}
+		hints := pipeline.EntryHints{Timestamp: entry.ts}
+		if err := fc.Logger.ProcessLogWithHints(fm.tag, message, hints, labels); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// handshake authenticates the client with the shared key:
+// server HELO, client PING, server PONG.
+func (fc *ForwardCollector) handshake(dec *msgpack.Decoder, enc *msgpack.Encoder) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	helo := []interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      "",
+		"keepalive": true,
+	}}
+	if err := enc.Encode(helo); err != nil {
+		return err
+	}
+
+	v, err := dec.DecodeInterface()
+	if err != nil {
+		return err
+	}
+	ping, ok := v.([]interface{})
+	if !ok || len(ping) < 4 || ping[0] != "PING" {
+		return errors.New("expected PING")
+	}
+	clientHostname, _ := ping[1].(string)
+	salt, _ := ping[2].(string)
+	digest, _ := ping[3].(string)
+
+	if digest != fluent.Digest(salt, clientHostname, string(nonce), fc.cfg.ForwardSharedKey) {
+		enc.Encode([]interface{}{"PONG", false, "shared key mismatch", fc.hostname, ""})
+		return fmt.Errorf("shared key mismatch from %s", clientHostname)
+	}
+
+	return enc.Encode([]interface{}{"PONG", true, "", fc.hostname, fluent.Digest(salt, fc.hostname, string(nonce), fc.cfg.ForwardSharedKey)})
+}
@@ -0,0 +1,198 @@
+package fluentforward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"log-agent/internal/fluent"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// messageFields are the record fields tried, in order, for the log line
+// itself. Docker's fluentd driver and Fluent Bit's tail input use "log".
+var messageFields = []string{"log", "message", "msg"}
+
+type forwardEntry struct {
+	ts     time.Time
+	record map[string]interface{}
+}
+
+// forwardMessage is one decoded Forward protocol message in any of its modes:
+//
+//	Message:                 [tag, time, record, option?]
+//	Forward:                 [tag, [[time, record], ...], option?]
+//	PackedForward:           [tag, bin(msgpack entries), option?]
+//	CompressedPackedForward: PackedForward with option.compressed = "gzip"
+type forwardMessage struct {
+	tag     string
+	entries []forwardEntry
+	chunk   string
+}
+
+func decodeMessage(msg []interface{}) (*forwardMessage, error) {
+	if len(msg) < 2 {
+		return nil, errors.New("message has fewer than two elements")
+	}
+	tag, ok := msg[0].(string)
+	if !ok {
+		return nil, errors.New("tag is not a string")
+	}
+	fm := &forwardMessage{tag: tag}
+
+	// The option map follows the entries: at index 3 in Message mode and
+	// at index 2 otherwise.
+	optionIndex := 2
+	var option map[string]interface{}
+
+	switch entries := msg[1].(type) {
+	case []interface{}:
+		for _, e := range entries {
+			entry, err := decodeEntry(e)
+			if err != nil {
+				return nil, err
+			}
+			fm.entries = append(fm.entries, entry)
+		}
+	case string:
+		if len(msg) > optionIndex {
+			option, _ = msg[optionIndex].(map[string]interface{})
+		}
+		packed := []byte(entries)
+		if compressed, _ := option["compressed"].(string); compressed != "" {
+			if compressed != "gzip" {
+				return nil, fmt.Errorf("unsupported compression %q", compressed)
+			}
+			var err error
+			if packed, err = gunzip(packed); err != nil {
+				return nil, err
+			}
+		}
+		packedEntries, err := decodePacked(packed)
+		if err != nil {
+			return nil, err
+		}
+		fm.entries = packedEntries
+	default:
+		if len(msg) < 3 {
+			return nil, errors.New("message mode requires a record")
+		}
+		entry, err := decodeEntry([]interface{}{msg[1], msg[2]})
+		if err != nil {
+			return nil, err
+		}
+		fm.entries = []forwardEntry{entry}
+		optionIndex = 3
+	}
+
+	if option == nil && len(msg) > optionIndex {
+		option, _ = msg[optionIndex].(map[string]interface{})
+	}
+	fm.chunk, _ = option["chunk"].(string)
+	return fm, nil
+}
+
+func decodeEntry(v interface{}) (forwardEntry, error) {
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) < 2 {
+		return forwardEntry{}, errors.New("entry is not a [time, record] pair")
+	}
+	ts, ok := fluent.ParseTime(pair[0])
+	if !ok {
+		return forwardEntry{}, fmt.Errorf("unsupported time %T", pair[0])
+	}
+	record, ok := pair[1].(map[string]interface{})
+	if !ok {
+		return forwardEntry{}, errors.New("record is not a map")
+	}
+	return forwardEntry{ts: ts, record: record}, nil
+}
+
+// decodePacked decodes the concatenated [time, record] entries of the
+// PackedForward modes.
+func decodePacked(data []byte) ([]forwardEntry, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.UseLooseInterfaceDecoding(true)
+	var entries []forwardEntry
+	for {
+		v, err := dec.DecodeInterface()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding packed entries: %w", err)
+		}
+		entry, err := decodeEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	// Senders may append each chunk as its own gzip member; the reader
+	// decodes concatenated members as one stream.
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing entries: %w", err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// entryFields splits a record into the log line and labels. Records without
+// a log field are shipped whole as JSON.
+func entryFields(tag string, record map[string]interface{}) (string, map[string]string) {
+	labels := map[string]string{
+		"forward": "true",
+		"tag":     tag,
+	}
+
+	message := ""
+	messageField := ""
+	for _, f := range messageFields {
+		if v, ok := record[f]; ok {
+			message, messageField = labelValue(v), f
+			break
+		}
+	}
+	if messageField == "" {
+		data, _ := json.Marshal(record)
+		message = string(data)
+	}
+
+	for k, v := range record {
+		if k == messageField {
+			continue
+		}
+		labels[k] = labelValue(v)
+	}
+	// Docker's fluentd driver reports names as the API does, with a slash.
+	if name, ok := labels["container_name"]; ok {
+		labels["container_name"] = strings.TrimPrefix(name, "/")
+	}
+	return message, labels
+}
+
+func labelValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case nil:
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
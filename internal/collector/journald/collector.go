@@ -2,27 +2,59 @@ package journald
 
 import (
 	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"log-agent/internal/config"
 	"log-agent/internal/processor"
+	"log-agent/internal/utils"
 )
 
+const cursorFileName = "journald-cursor.json"
+
 type JournaldCollector struct {
-	stopChan chan struct{}
-	Logger   *processor.LogProcessor
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+	Logger      *processor.LogProcessor
+	cfg         config.Config
+	containers  *utils.ContainerRegistry
+	checkpoints *utils.CheckpointStore
 }
 
-func NewJournaldCollector(logger *processor.LogProcessor) *JournaldCollector {
+func NewJournaldCollector(logger *processor.LogProcessor, cfg config.Config, containers *utils.ContainerRegistry) *JournaldCollector {
 	return &JournaldCollector{
-		stopChan: make(chan struct{}),
-		Logger:   logger,
+		stopChan:    make(chan struct{}),
+		Logger:      logger,
+		cfg:         cfg,
+		containers:  containers,
+		checkpoints: utils.NewCheckpointStore(filepath.Join(cfg.StateDir, cursorFileName), 5*time.Second),
 	}
 }
 
 func (jc *JournaldCollector) Start() {
 	log.Println("[INFO] Journald Collector started...")
-	go StartJournalStream(jc.Logger, jc.stopChan)
+	for _, source := range resolveJournalSources(jc.cfg.JournaldDirs, jc.cfg.JournaldNamespaces) {
+		jc.wg.Add(1)
+		go func(source journalSource) {
+			defer jc.wg.Done()
+			StartJournalStream(jc.Logger, jc.cfg, jc.containers, jc.checkpoints, source, jc.stopChan)
+		}(source)
+	}
 }
 
 func (jc *JournaldCollector) Stop() {
 	log.Println("[WARNING] Stopping Journald Collector...")
 	close(jc.stopChan)
+	// Let the streams record their last cursors before the state file is written.
+	done := make(chan struct{})
+	go func() {
+		jc.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+	}
+	jc.checkpoints.Close()
 }
@@ -0,0 +1,94 @@
+package journald
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxExportFieldBytes bounds a single binary field, so a corrupt length
+// prefix cannot make the reader allocate arbitrary amounts of memory.
+const maxExportFieldBytes = 64 * 1024 * 1024
+
+// exportReader decodes the journal export format
+// (application/vnd.fdo.journal): entries are separated by an empty line and
+// each field is either `NAME=value\n` or, for values that may contain
+// newlines or binary data, `NAME\n` followed by a little-endian 64-bit length,
+// the raw value and a newline.
+type exportReader struct {
+	r *bufio.Reader
+}
+
+func newExportReader(r io.Reader) *exportReader {
+	return &exportReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the fields of the next entry, or io.EOF once the stream ends.
+func (er *exportReader) Next() (map[string]string, error) {
+	fields := make(map[string]string)
+
+	for {
+		line, err := er.r.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) == 0 {
+				if len(fields) > 0 {
+					return fields, nil
+				}
+				return nil, io.EOF
+			}
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			if len(fields) == 0 {
+				// Tolerate extra separators between entries.
+				continue
+			}
+			return fields, nil
+		}
+
+		if name, value, ok := bytes.Cut(line, []byte("=")); ok {
+			fields[string(name)] = string(value)
+			continue
+		}
+
+		value, err := er.readBinary()
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", line, err)
+		}
+		fields[string(line)] = value
+	}
+}
+
+func (er *exportReader) readBinary() (string, error) {
+	var size uint64
+	if err := binary.Read(er.r, binary.LittleEndian, &size); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if size > maxExportFieldBytes {
+		return "", fmt.Errorf("value of %d bytes exceeds limit", size)
+	}
+
+	value := make([]byte, size+1)
+	if _, err := io.ReadFull(er.r, value); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if value[size] != '\n' {
+		return "", errors.New("missing newline after binary value")
+	}
+	return string(value[:size]), nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package journald
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"log-agent/internal/pipeline"
+)
+
+// promoteAllFields in the promoted field list copies every journal field.
+const promoteAllFields = "*"
+
+// priorityLevel maps the entry's syslog PRIORITY to a level. The journal
+// records it explicitly, so it takes precedence over guessing from the text.
+func priorityLevel(prio string) string {
+	n, err := strconv.Atoi(prio)
+	if err != nil {
+		return ""
+	}
+	return pipeline.SyslogLevel(n)
+}
+
+func realtimeTimestamp(usec uint64) time.Time {
+	if usec == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(usec)).UTC()
+}
+
+// promoteFields copies the configured journal fields into metadata, named
+// in lower case without the leading underscores (`_COMM` becomes `comm`).
+// Labels already set are left alone.
+func promoteFields(metadata, fields map[string]string, promoted []string) {
+	for _, name := range promoted {
+		if name == promoteAllFields {
+			for field, v := range fields {
+				// MESSAGE is the entry itself and `__` fields are the journal's
+				// own addressing (cursor, timestamps), already used elsewhere.
+				if field != "MESSAGE" && !strings.HasPrefix(field, "__") {
+					promoteField(metadata, field, v)
+				}
+			}
+			continue
+		}
+		if v, ok := fields[name]; ok {
+			promoteField(metadata, name, v)
+		}
+	}
+}
+
+func promoteField(metadata map[string]string, field, value string) {
+	label := strings.ToLower(strings.TrimLeft(field, "_"))
+	if _, exists := metadata[label]; exists || label == "" {
+		return
+	}
+	metadata[label] = value
+}
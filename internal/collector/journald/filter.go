@@ -0,0 +1,182 @@
+package journald
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"log-agent/internal/config"
+	"log-agent/internal/utils"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+const (
+	fieldUnit       = "_SYSTEMD_UNIT"
+	fieldIdentifier = "SYSLOG_IDENTIFIER"
+	fieldPriority   = "PRIORITY"
+	fieldTransport  = "_TRANSPORT"
+	fieldBootID     = "_BOOT_ID"
+)
+
+// syslogPriorities lists the syslog priority names in numeric order.
+var syslogPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// journalFilter decides which journal entries are shipped. Include rules that
+// journald can evaluate itself are also installed as matches, so excluded
+// entries are never read; everything is checked again in-process.
+type journalFilter struct {
+	includeUnits       *utils.PatternList
+	excludeUnits       *utils.PatternList
+	includeIdentifiers map[string]bool
+	excludeIdentifiers map[string]bool
+	includeTransports  map[string]bool
+	excludeTransports  map[string]bool
+	includeBoots       map[string]bool
+	excludeBoots       map[string]bool
+	maxPriority        int
+
+	// literalUnits holds the unit include rules when none of them is a glob.
+	literalUnits []string
+}
+
+func newJournalFilter(cfg config.Config) *journalFilter {
+	f := &journalFilter{
+		includeUnits:       utils.NewPatternList(cfg.JournaldIncludeUnits),
+		excludeUnits:       utils.NewPatternList(cfg.JournaldExcludeUnits),
+		includeIdentifiers: toSet(cfg.JournaldIncludeIdentifiers, nil),
+		excludeIdentifiers: toSet(cfg.JournaldExcludeIdentifiers, nil),
+		includeTransports:  toSet(cfg.JournaldIncludeTransports, nil),
+		excludeTransports:  toSet(cfg.JournaldExcludeTransports, nil),
+		includeBoots:       toSet(cfg.JournaldIncludeBoots, normalizeBootID),
+		excludeBoots:       toSet(cfg.JournaldExcludeBoots, normalizeBootID),
+		maxPriority:        parsePriority(cfg.JournaldMaxPriority),
+	}
+
+	literal := len(cfg.JournaldIncludeUnits) > 0
+	for _, u := range cfg.JournaldIncludeUnits {
+		if u == "" || strings.ContainsAny(u, "*?[/") {
+			literal = false
+			break
+		}
+	}
+	if literal {
+		f.literalUnits = cfg.JournaldIncludeUnits
+	}
+	return f
+}
+
+// addMatches installs the include rules journald can evaluate. Matches on the
+// same field are ORed by journald and matches on different fields are ANDed.
+func (f *journalFilter) addMatches(j *sdjournal.Journal) error {
+	add := func(field, value string) error {
+		m := sdjournal.Match{Field: field, Value: value}
+		return j.AddMatch(m.String())
+	}
+
+	for _, u := range f.literalUnits {
+		if err := add(fieldUnit, u); err != nil {
+			return err
+		}
+	}
+	for id := range f.includeIdentifiers {
+		if err := add(fieldIdentifier, id); err != nil {
+			return err
+		}
+	}
+	for t := range f.includeTransports {
+		if err := add(fieldTransport, t); err != nil {
+			return err
+		}
+	}
+	for b := range f.includeBoots {
+		if err := add(fieldBootID, b); err != nil {
+			return err
+		}
+	}
+	if f.maxPriority < len(syslogPriorities)-1 {
+		for p := 0; p <= f.maxPriority; p++ {
+			if err := add(fieldPriority, strconv.Itoa(p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *journalFilter) allow(fields map[string]string) bool {
+	unit := fields[fieldUnit]
+	if !f.includeUnits.Empty() && !f.includeUnits.Match(unit) {
+		return false
+	}
+	if f.excludeUnits.Match(unit) {
+		return false
+	}
+	if !allowValue(fields[fieldIdentifier], f.includeIdentifiers, f.excludeIdentifiers) ||
+		!allowValue(fields[fieldTransport], f.includeTransports, f.excludeTransports) ||
+		!allowValue(fields[fieldBootID], f.includeBoots, f.excludeBoots) {
+		return false
+	}
+
+	if f.maxPriority < len(syslogPriorities)-1 {
+		prio, err := strconv.Atoi(fields[fieldPriority])
+		if err != nil || prio > f.maxPriority {
+			return false
+		}
+	}
+	return true
+}
+
+func allowValue(value string, include, exclude map[string]bool) bool {
+	if len(include) > 0 && !include[value] {
+		return false
+	}
+	return !exclude[value]
+}
+
+func toSet(values []string, normalize func(string) string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if normalize != nil {
+			v = normalize(v)
+		}
+		if v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// parsePriority accepts a syslog priority as a number (0-7) or a name such as
+// "warning", and returns 7 (ship everything) when it is empty or invalid.
+func parsePriority(val string) int {
+	all := len(syslogPriorities) - 1
+	if val == "" {
+		return all
+	}
+	if n, err := strconv.Atoi(val); err == nil && n >= 0 && n <= all {
+		return n
+	}
+	for i, name := range syslogPriorities {
+		if strings.EqualFold(val, name) {
+			return i
+		}
+	}
+	log.Printf("[WARNING] Invalid journald max priority %q, shipping all priorities", val)
+	return all
+}
+
+// normalizeBootID converts boot IDs to the journal's 32 hex digit form and
+// resolves "current" to the running boot.
+func normalizeBootID(id string) string {
+	if strings.EqualFold(id, "current") {
+		data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+		if err != nil {
+			log.Printf("[WARNING] Failed to read current boot id: %v", err)
+			return ""
+		}
+		id = strings.TrimSpace(string(data))
+	}
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
@@ -0,0 +1,109 @@
+package journald
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+
+	"log-agent/internal/config"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+)
+
+const journalExportContentType = "application/vnd.fdo.journal"
+
+// JournalRemoteCollector receives journals pushed by systemd-journal-upload,
+// speaking the same HTTP protocol as systemd-journal-remote, and ships their
+// entries like the local journal's.
+type JournalRemoteCollector struct {
+	Logger     *processor.LogProcessor
+	cfg        config.Config
+	containers *utils.ContainerRegistry
+	filter     *journalFilter
+	server     *http.Server
+}
+
+func NewJournalRemoteCollector(logger *processor.LogProcessor, cfg config.Config, containers *utils.ContainerRegistry) *JournalRemoteCollector {
+	jr := &JournalRemoteCollector{
+		Logger:     logger,
+		cfg:        cfg,
+		containers: containers,
+		filter:     newJournalFilter(cfg),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", jr.handleUpload)
+	jr.server = &http.Server{Addr: cfg.JournalRemoteAddr, Handler: mux}
+	return jr
+}
+
+func (jr *JournalRemoteCollector) Start() {
+	log.Printf("[INFO] Journal remote input listening on %s", jr.cfg.JournalRemoteAddr)
+
+	var err error
+	if jr.cfg.JournalRemoteCert != "" {
+		err = jr.server.ListenAndServeTLS(jr.cfg.JournalRemoteCert, jr.cfg.JournalRemoteKey)
+	} else {
+		err = jr.server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("[ERROR] Journal remote input stopped: %v", err)
+	}
+}
+
+func (jr *JournalRemoteCollector) Stop() {
+	log.Println("[WARNING] Stopping Journal remote input...")
+	jr.server.Close()
+}
+
+func (jr *JournalRemoteCollector) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Unsupported method.", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != journalExportContentType {
+		http.Error(w, "Content-Type must be "+journalExportContentType+".", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	sourceName := "remote:" + host
+
+	reader := newExportReader(r.Body)
+	shipped := 0
+	for {
+		fields, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("[WARNING] Malformed journal upload from %s after %d entries: %v", host, shipped, err)
+			http.Error(w, "Malformed journal export stream.", http.StatusBadRequest)
+			return
+		}
+
+		if fields["MESSAGE"] == "" || !jr.filter.allow(fields) {
+			continue
+		}
+
+		realtime, _ := strconv.ParseUint(fields["__REALTIME_TIMESTAMP"], 10, 64)
+		if err := shipEntry(jr.Logger, jr.cfg, jr.containers, fields, realtime, sourceName, ""); err != nil {
+			// The uploader keeps its own cursor and resends everything after
+			// the last accepted upload.
+			log.Printf("[ERROR] Failed to deliver journal entry from %s: %v", host, err)
+			http.Error(w, "Failed to deliver entries.", http.StatusServiceUnavailable)
+			return
+		}
+		shipped++
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "OK.\n")
+}
@@ -0,0 +1,127 @@
+package journald
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+const (
+	localSourceName = "local"
+	allNamespaces   = "*"
+)
+
+// defaultJournalDirs are the host's persistent and volatile journal roots,
+// used when namespaces are requested without explicit directories.
+var defaultJournalDirs = []string{"/var/log/journal", "/run/log/journal"}
+
+// journalSource is one journal the collector reads: the agent's own journal
+// (dir empty) or a directory of journal files, typically a host's
+// `<machine-id>` or `<machine-id>.<namespace>` directory mounted into a pod.
+type journalSource struct {
+	name      string
+	dir       string
+	namespace string
+}
+
+func (s journalSource) open() (*sdjournal.Journal, error) {
+	if s.dir == "" {
+		return sdjournal.NewJournal()
+	}
+	return sdjournal.NewJournalFromDir(s.dir)
+}
+
+// cursorKey keeps the local journal on the key used before directory sources
+// existed, so upgrading agents resume where they left off.
+func (s journalSource) cursorKey() string {
+	if s.dir == "" {
+		return "cursor"
+	}
+	return "cursor:" + s.dir
+}
+
+// resolveJournalSources expands the configured roots into the directories
+// that actually hold journal files. Without roots or namespaces the agent's
+// own journal is read, as before.
+func resolveJournalSources(dirs, namespaces []string) []journalSource {
+	if len(dirs) == 0 && len(namespaces) == 0 {
+		return []journalSource{{name: localSourceName}}
+	}
+	if len(dirs) == 0 {
+		dirs = defaultJournalDirs
+	}
+
+	var sources []journalSource
+	for _, root := range dirs {
+		found := journalDirs(root, namespaces)
+		if len(found) == 0 {
+			log.Printf("[WARNING] No journal files found under %s.", root)
+		}
+		sources = append(sources, found...)
+	}
+	return sources
+}
+
+// journalDirs returns root itself when it holds journal files, plus every
+// machine-id subdirectory of the default namespace and of the requested
+// namespaces ("*" for all of them).
+func journalDirs(root string, namespaces []string) []journalSource {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[WARNING] Failed to read journal directory %s: %v", root, err)
+		}
+		return nil
+	}
+
+	var sources []journalSource
+	hasFiles := false
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() {
+			if strings.HasSuffix(name, ".journal") || strings.HasSuffix(name, ".journal~") {
+				hasFiles = true
+			}
+			continue
+		}
+
+		machineID, namespace, _ := strings.Cut(name, ".")
+		if !isMachineID(machineID) || !wantNamespace(namespace, namespaces) {
+			continue
+		}
+		dir := filepath.Join(root, name)
+		sources = append(sources, journalSource{name: dir, dir: dir, namespace: namespace})
+	}
+
+	if hasFiles {
+		sources = append([]journalSource{{name: root, dir: root}}, sources...)
+	}
+	return sources
+}
+
+func wantNamespace(namespace string, namespaces []string) bool {
+	if namespace == "" {
+		return true
+	}
+	for _, ns := range namespaces {
+		if ns == allNamespaces || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func isMachineID(name string) bool {
+	if len(name) != 32 {
+		return false
+	}
+	for _, c := range name {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
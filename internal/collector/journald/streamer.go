@@ -4,47 +4,55 @@ import (
 	"log"
 	"time"
 
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
 	"log-agent/internal/processor"
+	"log-agent/internal/utils"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
 )
 
-func StartJournalStream(logger *processor.LogProcessor, stopChan chan struct{}) {
-	j, err := sdjournal.NewJournal()
+const (
+	minDeliveryBackoff = time.Second
+	maxDeliveryBackoff = 30 * time.Second
+)
+
+func StartJournalStream(logger *processor.LogProcessor, cfg config.Config, containers *utils.ContainerRegistry, checkpoints *utils.CheckpointStore, src journalSource, stopChan chan struct{}) {
+	j, err := src.open()
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to open journald: %v", err)
+		log.Printf("[ERROR] Failed to open journal %s: %v", src.name, err)
+		return
 	}
 	defer j.Close()
 
 	j.FlushMatches()
-
-	if err := j.SeekTail(); err != nil {
-		log.Fatalf("[ERROR] Failed to execute SeekTail: %v", err)
-	}
-	if _, err := j.Previous(); err != nil {
-		log.Fatalf("[ERROR] Failed to execute Previous after SeekTail: %v", err)
+	filter := newJournalFilter(cfg)
+	if err := filter.addMatches(j); err != nil {
+		log.Printf("[ERROR] Failed to add matches to journal %s: %v", src.name, err)
+		return
 	}
 
+	cursorKey := src.cursorKey()
+	seekStart(j, cfg, checkpoints, cursorKey)
+	log.Printf("[INFO] Reading journal %s.", src.name)
+
 	for {
 		select {
 		case <-stopChan:
-			log.Println("[INFO] Journald stream stopped.")
+			log.Printf("[INFO] Journald stream for %s stopped.", src.name)
 			return
 		default:
 		}
 
-		switch ev := j.Wait(time.Second); ev {
-		case sdjournal.SD_JOURNAL_APPEND, sdjournal.SD_JOURNAL_INVALIDATE:
-		default:
-			continue
-		}
-
 		n, err := j.Next()
 		if err != nil {
 			log.Printf("[ERROR] Failed to call Next(): %v", err)
+			time.Sleep(time.Second)
 			continue
 		}
 		if n == 0 {
+			// Caught up: block until journald appends or rotates files.
+			j.Wait(time.Second)
 			continue
 		}
 
@@ -55,25 +63,98 @@ func StartJournalStream(logger *processor.LogProcessor, stopChan chan struct{})
 		}
 
 		msg := entry.Fields["MESSAGE"]
-		if msg == "" {
+		if msg == "" || !filter.allow(entry.Fields) {
+			checkpoints.Set(cursorKey, entry.Cursor)
 			continue
 		}
 
-		source := getOrDefault(entry.Fields, "SYSLOG_IDENTIFIER", "unknown")
-		prio := getOrDefault(entry.Fields, "PRIORITY", "unknown")
-		unit := getOrDefault(entry.Fields, "_SYSTEMD_UNIT", "")
-		pid := getOrDefault(entry.Fields, "_PID", "")
-		uid := getOrDefault(entry.Fields, "_UID", "")
-
-		metadata := map[string]string{
-			"priority": prio,
-			"unit":     unit,
-			"pid":      pid,
-			"uid":      uid,
-			"journal":  "true",
+		// The cursor only moves past an entry once it was delivered, so a
+		// failed entry is retried before reading on.
+		backoff := minDeliveryBackoff
+		for {
+			err := shipEntry(logger, cfg, containers, entry.Fields, entry.RealtimeTimestamp, src.name, src.namespace)
+			if err == nil {
+				break
+			}
+			log.Printf("[ERROR] Failed to deliver journal entry from %s, retrying in %s: %v", src.name, backoff, err)
+			select {
+			case <-stopChan:
+				log.Printf("[INFO] Journald stream for %s stopped.", src.name)
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxDeliveryBackoff)
 		}
+		checkpoints.Set(cursorKey, entry.Cursor)
+	}
+}
+
+// shipEntry maps a journal entry's fields to labels, level and timestamp and
+// sends it through the pipeline. It is shared by the local journal reader and
+// the journal export input.
+func shipEntry(logger *processor.LogProcessor, cfg config.Config, containers *utils.ContainerRegistry, fields map[string]string, realtimeUsec uint64, sourceName, namespace string) error {
+	source := getOrDefault(fields, "SYSLOG_IDENTIFIER", "unknown")
+	prio := getOrDefault(fields, "PRIORITY", "unknown")
+	unit := getOrDefault(fields, "_SYSTEMD_UNIT", "")
+	pid := getOrDefault(fields, "_PID", "")
+	uid := getOrDefault(fields, "_UID", "")
+
+	metadata := map[string]string{
+		"priority":       prio,
+		"unit":           unit,
+		"pid":            pid,
+		"uid":            uid,
+		"journal":        "true",
+		"journal_source": sourceName,
+	}
+	if namespace := getOrDefault(fields, "_NAMESPACE", namespace); namespace != "" {
+		metadata["journal_namespace"] = namespace
+	}
+	promoteFields(metadata, fields, cfg.JournaldFields)
+
+	if containerID := getOrDefault(fields, "CONTAINER_ID_FULL", fields["CONTAINER_ID"]); containerID != "" {
+		source = addContainerMetadata(metadata, fields, containerID, containers)
+	}
 
-		logger.ProcessLog(source, msg, metadata)
+	hints := pipeline.EntryHints{
+		Timestamp: realtimeTimestamp(realtimeUsec),
+		Level:     priorityLevel(prio),
+	}
+	return logger.ProcessLogWithHints(source, fields["MESSAGE"], hints, metadata)
+}
+
+// seekStart positions the journal just before the first entry to ship: after
+// the saved cursor, or when it is missing or has been vacuumed, at the start
+// of the configured since window or at the tail.
+func seekStart(j *sdjournal.Journal, cfg config.Config, checkpoints *utils.CheckpointStore, cursorKey string) {
+	if cursor, ok := checkpoints.Get(cursorKey); ok {
+		if err := j.SeekCursor(cursor); err == nil {
+			// SeekCursor lands on the nearest entry even if the cursor's own
+			// entry is gone, so check it is still there before trusting it.
+			// The loop's first Next() then moves past the shipped entry.
+			if _, err := j.Next(); err == nil && j.TestCursor(cursor) == nil {
+				log.Println("[INFO] Resuming journald from saved cursor.")
+				return
+			}
+		}
+		log.Println("[WARNING] Saved journald cursor is no longer in the journal.")
+	}
+
+	if cfg.JournaldSince > 0 {
+		since := time.Now().Add(-cfg.JournaldSince)
+		err := j.SeekRealtimeUsec(uint64(since.UnixMicro()))
+		if err == nil {
+			log.Printf("[INFO] Reading journald entries since %s.", since.Format(time.RFC3339))
+			return
+		}
+		log.Printf("[WARNING] Failed to seek journald to %s: %v", since.Format(time.RFC3339), err)
+	}
+
+	if err := j.SeekTail(); err != nil {
+		log.Printf("[ERROR] Failed to execute SeekTail: %v", err)
+	}
+	if _, err := j.Previous(); err != nil {
+		log.Printf("[ERROR] Failed to execute Previous after SeekTail: %v", err)
 	}
 }
 
@@ -83,3 +164,18 @@ func getOrDefault(fields map[string]string, key, fallback string) string {
 	}
 	return fallback
 }
+
+// addContainerMetadata labels entries written by Docker's journald log driver
+// like the Docker collector would and returns the container name as source.
+func addContainerMetadata(metadata, fields map[string]string, containerID string, containers *utils.ContainerRegistry) string {
+	if known, ok := containers.Lookup(containerID); ok {
+		for k, v := range known {
+			metadata[k] = v
+		}
+		return metadata["container_name"]
+	}
+
+	metadata["container_id"] = containerID
+	metadata["container_name"] = fields["CONTAINER_NAME"]
+	return metadata["container_name"]
+}
@@ -0,0 +1,218 @@
+package kmsg
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	DevicePath = "/dev/kmsg"
+
+	checkpointFile = "kmsg.json"
+	checkpointKey  = "seq"
+
+	// A single read returns exactly one record, which the kernel caps well
+	// below this.
+	maxRecordBytes = 8192
+
+	minDeliveryBackoff = time.Second
+	maxDeliveryBackoff = 30 * time.Second
+)
+
+// KmsgCollector reads the kernel ring buffer from /dev/kmsg, which holds
+// OOM-killer, segfault and storage errors even where journald isn't running.
+type KmsgCollector struct {
+	stopChan    chan struct{}
+	done        chan struct{}
+	Logger      *processor.LogProcessor
+	hostInfo    map[string]string
+	checkpoints *utils.CheckpointStore
+	device      *os.File
+	bootID      string
+	bootTime    time.Time
+	pending     *record
+}
+
+func NewKmsgCollector(logger *processor.LogProcessor, cfg config.Config) *KmsgCollector {
+	device, err := os.Open(DevicePath)
+	if err != nil {
+		log.Printf("[ERROR] Failed to open %s: %v", DevicePath, err)
+	}
+
+	return &KmsgCollector{
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+		Logger:      logger,
+		hostInfo:    utils.GetHostMetadata(),
+		checkpoints: utils.NewCheckpointStore(filepath.Join(cfg.StateDir, checkpointFile), 5*time.Second),
+		device:      device,
+		bootID:      readBootID(),
+		bootTime:    bootTime(),
+	}
+}
+
+func (kc *KmsgCollector) Start() {
+	defer close(kc.done)
+	defer kc.flushPending()
+
+	if kc.device == nil {
+		return
+	}
+	log.Println("[INFO] Kernel log collector started...")
+
+	lastSeq, resume := kc.lastSeq()
+	buf := make([]byte, maxRecordBytes)
+	for {
+		n, err := kc.device.Read(buf)
+		if err != nil {
+			select {
+			case <-kc.stopChan:
+				return
+			default:
+			}
+			if errors.Is(err, syscall.EPIPE) {
+				// The ring buffer wrapped past our read position.
+				log.Println("[WARNING] Kernel log records were overwritten before they could be read.")
+				continue
+			}
+			log.Printf("[ERROR] Failed to read %s: %v", DevicePath, err)
+			return
+		}
+
+		rec, err := parseRecord(string(buf[:n]))
+		if err != nil {
+			log.Printf("[WARNING] Skipping malformed kernel log record: %v", err)
+			continue
+		}
+		if resume && rec.seq <= lastSeq {
+			continue
+		}
+		kc.handleRecord(rec)
+	}
+}
+
+func (kc *KmsgCollector) Stop() {
+	log.Println("[WARNING] Stopping Kernel log collector...")
+	close(kc.stopChan)
+	if kc.device != nil {
+		kc.device.Close()
+	}
+	select {
+	case <-kc.done:
+	case <-time.After(5 * time.Second):
+	}
+	kc.checkpoints.Close()
+}
+
+// handleRecord joins the pieces older kernels emit for lines printed in
+// several calls, then ships complete lines.
+func (kc *KmsgCollector) handleRecord(rec record) {
+	if rec.flags == flagContinued && kc.pending != nil {
+		kc.pending.message += rec.message
+		kc.pending.seq = rec.seq
+		return
+	}
+	kc.flushPending()
+	if rec.flags == flagContinueStart {
+		kc.pending = &rec
+		return
+	}
+	kc.emit(rec)
+}
+
+func (kc *KmsgCollector) flushPending() {
+	if kc.pending != nil {
+		kc.emit(*kc.pending)
+		kc.pending = nil
+	}
+}
+
+// emit ships rec and only then stores its seq. The device can't be re-read
+// from a given record, so a failed delivery is retried until it succeeds or
+// the collector stops.
+func (kc *KmsgCollector) emit(rec record) {
+	metadata := make(map[string]string, len(kc.hostInfo)+4+len(rec.dictionary))
+	for k, v := range kc.hostInfo {
+		metadata[k] = v
+	}
+	metadata["kmsg"] = "true"
+	metadata["facility"] = rec.facilityName()
+	metadata["priority"] = strconv.Itoa(rec.severity)
+	metadata["seq"] = strconv.FormatUint(rec.seq, 10)
+	for k, v := range rec.dictionary {
+		metadata[strings.ToLower(k)] = v
+	}
+
+	hints := pipeline.EntryHints{
+		Timestamp: kc.bootTime.Add(time.Duration(rec.usec) * time.Microsecond),
+		Level:     pipeline.SyslogLevel(rec.severity),
+	}
+	backoff := minDeliveryBackoff
+	for {
+		err := kc.Logger.ProcessLogWithHints("kernel", rec.message, hints, metadata)
+		if err == nil {
+			break
+		}
+		log.Printf("[ERROR] Failed to deliver kernel log record %d, retrying in %s: %v", rec.seq, backoff, err)
+		select {
+		case <-kc.stopChan:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxDeliveryBackoff)
+	}
+	kc.checkpoints.Set(checkpointKey, fmt.Sprintf("%s:%d", kc.bootID, rec.seq))
+}
+
+// lastSeq returns the last shipped sequence number. Sequence numbers restart
+// at every boot, so a checkpoint from another boot means nothing was shipped
+// yet from the current buffer.
+func (kc *KmsgCollector) lastSeq() (uint64, bool) {
+	val, ok := kc.checkpoints.Get(checkpointKey)
+	if !ok {
+		return 0, false
+	}
+	bootID, seq, found := strings.Cut(val, ":")
+	if !found || bootID != kc.bootID {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func readBootID() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		log.Printf("[WARNING] Failed to read boot id: %v", err)
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// bootTime is the wall-clock time of boot as seen by the monotonic clock the
+// kernel stamps records with.
+func bootTime() time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		log.Printf("[WARNING] Failed to read monotonic clock: %v", err)
+		return time.Now()
+	}
+	return time.Now().Add(-time.Duration(ts.Nano()))
+}
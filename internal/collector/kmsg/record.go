@@ -0,0 +1,100 @@
+package kmsg
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Continuation flags of older kernels, which split a line printed in pieces
+// (pr_cont) into several records: 'c' starts it and '+' continues it.
+const (
+	flagContinueStart = "c"
+	flagContinued     = "+"
+)
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// record is one /dev/kmsg record:
+//
+//	priority,sequence,timestamp_us,flags[,...];message
+//	 KEY=value
+//
+// where the indented lines are the device dictionary (SUBSYSTEM, DEVICE).
+type record struct {
+	facility   int
+	severity   int
+	seq        uint64
+	usec       int64
+	flags      string
+	message    string
+	dictionary map[string]string
+}
+
+func parseRecord(data string) (record, error) {
+	header, body, ok := strings.Cut(data, ";")
+	if !ok {
+		return record{}, errors.New("missing ';' after record header")
+	}
+
+	parts := strings.Split(header, ",")
+	if len(parts) < 4 {
+		return record{}, errors.New("short record header")
+	}
+	prio, err1 := strconv.Atoi(parts[0])
+	seq, err2 := strconv.ParseUint(parts[1], 10, 64)
+	usec, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return record{}, errors.New("malformed record header")
+	}
+
+	r := record{
+		facility: prio >> 3,
+		severity: prio & 7,
+		seq:      seq,
+		usec:     usec,
+		flags:    parts[3],
+	}
+
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	r.message = unescape(lines[0])
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(strings.TrimPrefix(line, " "), "="); ok {
+			if r.dictionary == nil {
+				r.dictionary = make(map[string]string)
+			}
+			r.dictionary[key] = unescape(value)
+		}
+	}
+	return r, nil
+}
+
+func (r record) facilityName() string {
+	if r.facility >= 0 && r.facility < len(facilityNames) {
+		return facilityNames[r.facility]
+	}
+	return strconv.Itoa(r.facility)
+}
+
+// unescape reverses the kernel's \xNN escaping of non-printable bytes.
+func unescape(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if n, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"log-agent/internal/config"
 	"log-agent/internal/processor"
 	"log-agent/internal/utils"
 
@@ -24,9 +25,10 @@ type KubernetesCollector struct {
 	namespace   string
 	Logger      *processor.LogProcessor
 	hostInfo    map[string]string
+	cfg         config.Config
 }
 
-func NewKubernetesCollector(logger *processor.LogProcessor) *KubernetesCollector {
+func NewKubernetesCollector(logger *processor.LogProcessor, cfg config.Config) *KubernetesCollector {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		log.Fatalf("Error creating in-cluster Kubernetes config: %v", err)
@@ -43,6 +45,7 @@ func NewKubernetesCollector(logger *processor.LogProcessor) *KubernetesCollector
 		namespace: getNamespace(),
 		Logger:    logger,
 		hostInfo:  utils.GetHostMetadata(),
+		cfg:       cfg,
 	}
 
 	collector.nodeName = collector.getCurrentNodeName()
@@ -126,7 +129,7 @@ func (kc *KubernetesCollector) Start() {
 				podKey := fmt.Sprintf("%s-%s", pod.Namespace, pod.UID)
 
 				if _, loaded := kc.logTrackers.LoadOrStore(podKey, true); !loaded {
-					logStreamer := NewKubernetesLogStreamer(kc.clientset, kc.Logger, pod.Namespace, pod.Name, podKey, kc.hostInfo)
+					logStreamer := NewKubernetesLogStreamer(kc.clientset, kc.Logger, pod.Namespace, pod.Name, podKey, kc.hostInfo, kc.cfg.MaxLineBytes, kc.cfg.KubernetesTimestamps)
 					go logStreamer.StreamLogs()
 				}
 			}
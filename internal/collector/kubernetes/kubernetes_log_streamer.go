@@ -6,18 +6,21 @@ import (
 	"log"
 
 	"log-agent/internal/processor"
+	"log-agent/internal/utils"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 type KubernetesLogStreamer struct {
-	clientset *kubernetes.Clientset
-	logger    *processor.LogProcessor
-	namespace string
-	podName   string
-	podKey    string
-	hostInfo  map[string]string
+	clientset    *kubernetes.Clientset
+	logger       *processor.LogProcessor
+	namespace    string
+	podName      string
+	podKey       string
+	hostInfo     map[string]string
+	maxLineBytes int
+	timestamps   bool
 }
 
 func NewKubernetesLogStreamer(
@@ -27,22 +30,27 @@ func NewKubernetesLogStreamer(
 	podName,
 	podKey string,
 	hostInfo map[string]string,
+	maxLineBytes int,
+	timestamps bool,
 ) *KubernetesLogStreamer {
 	return &KubernetesLogStreamer{
-		clientset: clientset,
-		logger:    logger,
-		namespace: namespace,
-		podName:   podName,
-		podKey:    podKey,
-		hostInfo:  hostInfo,
+		clientset:    clientset,
+		logger:       logger,
+		namespace:    namespace,
+		podName:      podName,
+		podKey:       podKey,
+		hostInfo:     hostInfo,
+		maxLineBytes: maxLineBytes,
+		timestamps:   timestamps,
 	}
 }
 
 func (kls *KubernetesLogStreamer) StreamLogs() {
 	ctx := context.Background()
 	logOptions := &v1.PodLogOptions{
-		Follow:    true,
-		TailLines: func(i int64) *int64 { return &i }(10),
+		Follow:     true,
+		TailLines:  func(i int64) *int64 { return &i }(10),
+		Timestamps: kls.timestamps,
 	}
 
 	logRequest := kls.clientset.CoreV1().Pods(kls.namespace).GetLogs(kls.podName, logOptions)
@@ -53,22 +61,31 @@ func (kls *KubernetesLogStreamer) StreamLogs() {
 	}
 	defer logStream.Close()
 
-	buf := make([]byte, 4096)
+	reader := utils.NewLineReader(logStream, kls.maxLineBytes)
 	for {
-		bytesRead, err := logStream.Read(buf)
+		line, truncated, err := reader.ReadLine()
 		if err != nil {
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				log.Printf("Error reading logs for pod %s/%s: %v", kls.namespace, kls.podName, err)
 			}
-			log.Printf("Error reading logs for pod %s/%s: %v", kls.namespace, kls.podName, err)
 			break
 		}
 
-		logMessage := string(buf[:bytesRead])
-
-		kls.logger.ProcessLog("kubernetes", logMessage, map[string]string{
+		metadata := map[string]string{
 			"pod_name":  kls.podName,
 			"namespace": kls.namespace,
-		})
+		}
+		if truncated {
+			metadata["truncated"] = "true"
+		}
+
+		if kls.timestamps {
+			if ts, msg, ok := utils.SplitTimestampPrefix(line); ok {
+				kls.logger.ProcessLogAt("kubernetes", msg, ts, metadata)
+				continue
+			}
+		}
+
+		kls.logger.ProcessLog("kubernetes", line, metadata)
 	}
 }
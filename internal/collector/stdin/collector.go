@@ -0,0 +1,76 @@
+package stdin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"log-agent/internal/config"
+	"log-agent/internal/processor"
+	"log-agent/internal/utils"
+)
+
+// StdinCollector ships a one-off stream, such as a job's piped output, line
+// by line until EOF.
+type StdinCollector struct {
+	Logger       *processor.LogProcessor
+	reader       io.Reader
+	labels       map[string]string
+	maxLineBytes int
+	hostInfo     map[string]string
+}
+
+func NewStdinCollector(logger *processor.LogProcessor, cfg config.Config, r io.Reader, labels map[string]string) *StdinCollector {
+	return &StdinCollector{
+		Logger:       logger,
+		reader:       r,
+		labels:       labels,
+		maxLineBytes: cfg.MaxLineBytes,
+		hostInfo:     utils.GetHostMetadata(),
+	}
+}
+
+// Run reads until EOF and returns an error if reading failed or any line
+// could not be delivered. Lines queued by batching outputs may still be in
+// flight once it returns.
+func (sc *StdinCollector) Run() error {
+	reader := utils.NewLineReader(sc.reader, sc.maxLineBytes)
+	lines, failed := 0, 0
+
+	for {
+		line, truncated, err := reader.ReadLine()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return fmt.Errorf("reading input: %w", err)
+			}
+			break
+		}
+		if line == "" {
+			continue
+		}
+
+		metadata := make(map[string]string, len(sc.hostInfo)+len(sc.labels)+2)
+		for k, v := range sc.hostInfo {
+			metadata[k] = v
+		}
+		metadata["stdin"] = "true"
+		for k, v := range sc.labels {
+			metadata[k] = v
+		}
+		if truncated {
+			metadata["truncated"] = "true"
+		}
+
+		lines++
+		if err := sc.Logger.ProcessLog("stdin", line, metadata); err != nil {
+			failed++
+		}
+	}
+
+	log.Printf("[INFO] Shipped %d of %d lines from stdin.", lines-failed, lines)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lines could not be delivered", failed, lines)
+	}
+	return nil
+}
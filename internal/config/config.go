@@ -1,9 +1,88 @@
 package config
 
+import "time"
+
 type Config struct {
-	Endpoint          string
-	APIKey            string
-	APISecret         string
-	IgnoredNamespaces []string
-	IgnoredContainers []string
+	Endpoint                   string
+	APIKey                     string
+	APISecret                  string
+	IgnoredNamespaces          []string
+	IgnoredContainers          []string
+	IgnoredImages              []string
+	IncludedContainers         []string
+	IncludedImages             []string
+	DockerOptIn                bool
+	DockerRawLabels            bool
+	DockerHosts                []string
+	DockerCertPath             string
+	DockerMode                 string
+	DockerDataRoot             string
+	PluginSocket               string
+	PluginStoreBytes           int64
+	MaxLineBytes               int
+	KubernetesTimestamps       bool
+	StateDir                   string
+	DockerInitialTail          string
+	StatusAddr                 string
+	JournaldSince              time.Duration
+	JournaldIncludeUnits       []string
+	JournaldExcludeUnits       []string
+	JournaldIncludeIdentifiers []string
+	JournaldExcludeIdentifiers []string
+	JournaldIncludeTransports  []string
+	JournaldExcludeTransports  []string
+	JournaldIncludeBoots       []string
+	JournaldExcludeBoots       []string
+	JournaldMaxPriority        string
+	JournaldFields             []string
+	JournaldDirs               []string
+	JournaldNamespaces         []string
+	JournalRemoteAddr          string
+	JournalRemoteCert          string
+	JournalRemoteKey           string
+	KmsgMode                   string
+	AuditMode                  string
+	AuditLogPath               string
+	ExecCommands               []ExecCommand
+	ForwardAddr                string
+	ForwardSocket              string
+	ForwardSharedKey           string
+	OutputBatchSize            int
+	OutputFlushInterval        time.Duration
+	ForwardOutputAddr          string
+	ForwardOutputTag           string
+	ForwardOutputSharedKey     string
+	ForwardOutputRequireAck    bool
+	ForwardOutputTLS           bool
+	ForwardOutputTLSCA         string
+	ForwardOutputTLSInsecure   bool
+	LokiURL                    string
+	LokiLabels                 []string
+	LokiTenant                 string
+	LokiFormat                 string
+	LokiUsername               string
+	LokiPassword               string
+	ElasticsearchURL           string
+	ElasticsearchIndex         string
+	ElasticsearchDataStream    bool
+	ElasticsearchDeadLetter    string
+	ElasticsearchUsername      string
+	ElasticsearchPassword      string
+	ElasticsearchAPIKey        string
+	SplunkHECURL               string
+	SplunkHECToken             string
+	SplunkHECIndex             string
+	SplunkHECSource            string
+	SplunkHECSourcetype        string
+	SplunkHECAck               bool
+	SplunkHECTLSCA             string
+	SplunkHECTLSInsecure       bool
+}
+
+// ExecCommand is a command whose output is collected: run every Interval, or
+// kept running and restarted when it exits if Interval is zero.
+type ExecCommand struct {
+	Name     string
+	Command  string
+	Interval time.Duration
 }
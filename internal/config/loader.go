@@ -1,17 +1,115 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"log-agent/internal/utils"
 )
 
+// defaultJournaldFields are the journal fields promoted to labels unless
+// LOGGYTO_JOURNALD_FIELDS says otherwise ("*" promotes all of them).
+const defaultJournaldFields = "SYSLOG_IDENTIFIER,_TRANSPORT,_BOOT_ID,_HOSTNAME,_COMM,_EXE,_CMDLINE,CODE_FILE,CODE_LINE,CODE_FUNC,CONTAINER_NAME"
+
 func LoadConfigFromEnv() Config {
 	return Config{
-		Endpoint:          os.Getenv("LOGGYTO_ENDPOINT"),
-		APIKey:            os.Getenv("LOGGYTO_API_KEY"),
-		APISecret:         os.Getenv("LOGGYTO_API_SECRET"),
-		IgnoredNamespaces: parseCommaList(os.Getenv("LOGGYTO_IGNORED_NAMESPACES")),
-		IgnoredContainers: parseCommaList(os.Getenv("LOGGYTO_IGNORED_CONTAINERS")),
+		Endpoint:                   os.Getenv("LOGGYTO_ENDPOINT"),
+		APIKey:                     os.Getenv("LOGGYTO_API_KEY"),
+		APISecret:                  os.Getenv("LOGGYTO_API_SECRET"),
+		IgnoredNamespaces:          parseCommaList(os.Getenv("LOGGYTO_IGNORED_NAMESPACES")),
+		IgnoredContainers:          parseCommaList(os.Getenv("LOGGYTO_IGNORED_CONTAINERS")),
+		IgnoredImages:              parseCommaList(os.Getenv("LOGGYTO_IGNORED_IMAGES")),
+		IncludedContainers:         parseCommaList(os.Getenv("LOGGYTO_INCLUDED_CONTAINERS")),
+		IncludedImages:             parseCommaList(os.Getenv("LOGGYTO_INCLUDED_IMAGES")),
+		DockerOptIn:                parseBool("LOGGYTO_DOCKER_OPT_IN", false),
+		DockerRawLabels:            parseBool("LOGGYTO_DOCKER_RAW_LABELS", true),
+		DockerHosts:                parseCommaList(os.Getenv("LOGGYTO_DOCKER_HOSTS")),
+		DockerCertPath:             os.Getenv("LOGGYTO_DOCKER_CERT_PATH"),
+		DockerMode:                 getOrDefault("LOGGYTO_DOCKER_MODE", "api"),
+		DockerDataRoot:             os.Getenv("LOGGYTO_DOCKER_DATA_ROOT"),
+		PluginSocket:               getOrDefault("LOGGYTO_PLUGIN_SOCKET", "/run/docker/plugins/loggyto.sock"),
+		PluginStoreBytes:           int64(parseInt("LOGGYTO_PLUGIN_STORE_BYTES", 10*1024*1024)),
+		MaxLineBytes:               parseInt("LOGGYTO_MAX_LINE_BYTES", utils.DefaultMaxLineBytes),
+		KubernetesTimestamps:       parseBool("LOGGYTO_K8S_TIMESTAMPS", true),
+		StateDir:                   getOrDefault("LOGGYTO_STATE_DIR", "/var/lib/loggyto"),
+		DockerInitialTail:          getOrDefault("LOGGYTO_DOCKER_INITIAL_TAIL", "0"),
+		StatusAddr:                 os.Getenv("LOGGYTO_STATUS_ADDR"),
+		JournaldSince:              parseDuration("LOGGYTO_JOURNALD_SINCE", 0),
+		JournaldIncludeUnits:       parseCommaList(os.Getenv("LOGGYTO_JOURNALD_INCLUDE_UNITS")),
+		JournaldExcludeUnits:       parseCommaList(os.Getenv("LOGGYTO_JOURNALD_EXCLUDE_UNITS")),
+		JournaldIncludeIdentifiers: parseCommaList(os.Getenv("LOGGYTO_JOURNALD_INCLUDE_IDENTIFIERS")),
+		JournaldExcludeIdentifiers: parseCommaList(os.Getenv("LOGGYTO_JOURNALD_EXCLUDE_IDENTIFIERS")),
+		JournaldIncludeTransports:  parseCommaList(os.Getenv("LOGGYTO_JOURNALD_INCLUDE_TRANSPORTS")),
+		JournaldExcludeTransports:  parseCommaList(os.Getenv("LOGGYTO_JOURNALD_EXCLUDE_TRANSPORTS")),
+		JournaldIncludeBoots:       parseCommaList(os.Getenv("LOGGYTO_JOURNALD_INCLUDE_BOOTS")),
+		JournaldExcludeBoots:       parseCommaList(os.Getenv("LOGGYTO_JOURNALD_EXCLUDE_BOOTS")),
+		JournaldMaxPriority:        os.Getenv("LOGGYTO_JOURNALD_MAX_PRIORITY"),
+		JournaldFields:             parseCommaList(getOrDefault("LOGGYTO_JOURNALD_FIELDS", defaultJournaldFields)),
+		JournaldDirs:               parseCommaList(os.Getenv("LOGGYTO_JOURNALD_DIRS")),
+		JournaldNamespaces:         parseCommaList(os.Getenv("LOGGYTO_JOURNALD_NAMESPACES")),
+		JournalRemoteAddr:          os.Getenv("LOGGYTO_JOURNAL_REMOTE_ADDR"),
+		JournalRemoteCert:          os.Getenv("LOGGYTO_JOURNAL_REMOTE_CERT"),
+		JournalRemoteKey:           os.Getenv("LOGGYTO_JOURNAL_REMOTE_KEY"),
+		KmsgMode:                   getOrDefault("LOGGYTO_KMSG", "auto"),
+		AuditMode:                  getOrDefault("LOGGYTO_AUDIT", "auto"),
+		AuditLogPath:               getOrDefault("LOGGYTO_AUDIT_LOG", "/var/log/audit/audit.log"),
+		ExecCommands:               parseExecCommands(),
+		ForwardAddr:                os.Getenv("LOGGYTO_FORWARD_ADDR"),
+		ForwardSocket:              os.Getenv("LOGGYTO_FORWARD_SOCKET"),
+		ForwardSharedKey:           os.Getenv("LOGGYTO_FORWARD_SHARED_KEY"),
+		OutputBatchSize:            parseInt("LOGGYTO_OUTPUT_BATCH_SIZE", 500),
+		OutputFlushInterval:        parseDuration("LOGGYTO_OUTPUT_FLUSH_INTERVAL", time.Second),
+		ForwardOutputAddr:          os.Getenv("LOGGYTO_FORWARD_OUTPUT_ADDR"),
+		ForwardOutputTag:           getOrDefault("LOGGYTO_FORWARD_OUTPUT_TAG", "loggyto"),
+		ForwardOutputSharedKey:     os.Getenv("LOGGYTO_FORWARD_OUTPUT_SHARED_KEY"),
+		ForwardOutputRequireAck:    parseBool("LOGGYTO_FORWARD_OUTPUT_REQUIRE_ACK", true),
+		ForwardOutputTLS:           parseBool("LOGGYTO_FORWARD_OUTPUT_TLS", false),
+		ForwardOutputTLSCA:         os.Getenv("LOGGYTO_FORWARD_OUTPUT_TLS_CA"),
+		ForwardOutputTLSInsecure:   parseBool("LOGGYTO_FORWARD_OUTPUT_TLS_INSECURE", false),
+		LokiURL:                    os.Getenv("LOGGYTO_LOKI_URL"),
+		LokiLabels:                 parseCommaList(getOrDefault("LOGGYTO_LOKI_LABELS", "host_name,namespace,container_name,level")),
+		LokiTenant:                 os.Getenv("LOGGYTO_LOKI_TENANT"),
+		LokiFormat:                 getOrDefault("LOGGYTO_LOKI_FORMAT", "protobuf"),
+		LokiUsername:               os.Getenv("LOGGYTO_LOKI_USERNAME"),
+		LokiPassword:               os.Getenv("LOGGYTO_LOKI_PASSWORD"),
+		ElasticsearchURL:           os.Getenv("LOGGYTO_ELASTICSEARCH_URL"),
+		ElasticsearchIndex:         os.Getenv("LOGGYTO_ELASTICSEARCH_INDEX"),
+		ElasticsearchDataStream:    parseBool("LOGGYTO_ELASTICSEARCH_DATA_STREAM", false),
+		ElasticsearchDeadLetter:    getOrDefault("LOGGYTO_ELASTICSEARCH_DEAD_LETTER_INDEX", "loggyto-dead-letter"),
+		ElasticsearchUsername:      os.Getenv("LOGGYTO_ELASTICSEARCH_USERNAME"),
+		ElasticsearchPassword:      os.Getenv("LOGGYTO_ELASTICSEARCH_PASSWORD"),
+		ElasticsearchAPIKey:        os.Getenv("LOGGYTO_ELASTICSEARCH_API_KEY"),
+		SplunkHECURL:               os.Getenv("LOGGYTO_SPLUNK_HEC_URL"),
+		SplunkHECToken:             os.Getenv("LOGGYTO_SPLUNK_HEC_TOKEN"),
+		SplunkHECIndex:             os.Getenv("LOGGYTO_SPLUNK_HEC_INDEX"),
+		SplunkHECSource:            getOrDefault("LOGGYTO_SPLUNK_HEC_SOURCE", "loggyto"),
+		SplunkHECSourcetype:        getOrDefault("LOGGYTO_SPLUNK_HEC_SOURCETYPE", "loggyto"),
+		SplunkHECAck:               parseBool("LOGGYTO_SPLUNK_HEC_ACK", false),
+		SplunkHECTLSCA:             os.Getenv("LOGGYTO_SPLUNK_HEC_TLS_CA"),
+		SplunkHECTLSInsecure:       parseBool("LOGGYTO_SPLUNK_HEC_TLS_INSECURE", false),
+	}
+}
+
+// parseExecCommands reads LOGGYTO_EXEC_<n>_COMMAND, with optional
+// LOGGYTO_EXEC_<n>_NAME and LOGGYTO_EXEC_<n>_INTERVAL, for n = 1, 2, ...
+// until the first missing command.
+func parseExecCommands() []ExecCommand {
+	var commands []ExecCommand
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("LOGGYTO_EXEC_%d_", i)
+		command := os.Getenv(prefix + "COMMAND")
+		if command == "" {
+			return commands
+		}
+		commands = append(commands, ExecCommand{
+			Name:     getOrDefault(prefix+"NAME", command),
+			Command:  command,
+			Interval: parseDuration(prefix+"INTERVAL", 0),
+		})
 	}
 }
 
@@ -25,3 +123,49 @@ func parseCommaList(val string) []string {
 	}
 	return parts
 }
+
+func getOrDefault(key, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
+
+func parseInt(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("[WARNING] Invalid value for %s: %q, using %d", key, val, fallback)
+		return fallback
+	}
+	return n
+}
+
+func parseBool(key string, fallback bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("[WARNING] Invalid value for %s: %q, using %t", key, val, fallback)
+		return fallback
+	}
+	return b
+}
+
+func parseDuration(key string, fallback time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("[WARNING] Invalid value for %s: %q, using %s", key, val, fallback)
+		return fallback
+	}
+	return d
+}
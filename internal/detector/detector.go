@@ -1,17 +1,26 @@
 package detector
 
 import (
+	"errors"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"log-agent/internal/collector/audit"
+	"log-agent/internal/collector/command"
 	"log-agent/internal/collector/docker"
+	"log-agent/internal/collector/dockerplugin"
+	"log-agent/internal/collector/fluentforward"
 	"log-agent/internal/collector/journald"
+	"log-agent/internal/collector/kmsg"
 	"log-agent/internal/collector/kubernetes"
+	"log-agent/internal/collector/stdin"
 	"log-agent/internal/config"
 	"log-agent/internal/logentry"
+	"log-agent/internal/outputs"
 	"log-agent/internal/pipeline"
 	"log-agent/internal/processor"
 	"log-agent/internal/sender"
@@ -23,12 +32,53 @@ type Collector interface {
 	Stop()
 }
 
-func DetectDocker() bool {
-	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
-		log.Println("[INFO] Detected Docker environment.")
-		return true
+// DetectDocker returns the Docker API endpoints to collect from: the
+// configured list, DOCKER_HOST, or every Docker-compatible socket found
+// locally, including Podman's rootful and rootless sockets.
+func DetectDocker(cfg config.Config) []string {
+	if len(cfg.DockerHosts) > 0 {
+		log.Printf("[INFO] Using configured Docker endpoints: %v", cfg.DockerHosts)
+		return cfg.DockerHosts
 	}
-	return false
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		log.Printf("[INFO] Using Docker endpoint from DOCKER_HOST: %s", host)
+		return []string{host}
+	}
+
+	sockets := []string{
+		"/var/run/docker.sock",
+		"/run/podman/podman.sock",
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sockets = append(sockets, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+
+	return detectSockets(sockets)
+}
+
+// detectSockets returns an endpoint for each existing socket, skipping paths
+// that resolve to one already found, such as podman-docker's docker.sock
+// symlink, so no container is collected twice.
+func detectSockets(sockets []string) []string {
+	var endpoints []string
+	seen := make(map[string]bool)
+	for _, path := range sockets {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			resolved = path
+		}
+		if seen[resolved] {
+			log.Printf("[INFO] Skipping %s, it is the same socket as %s", path, resolved)
+			continue
+		}
+		seen[resolved] = true
+		log.Printf("[INFO] Detected Docker-compatible socket at: %s", path)
+		endpoints = append(endpoints, "unix://"+path)
+	}
+	return endpoints
 }
 
 func DetectKubernetes() bool {
@@ -39,13 +89,14 @@ func DetectKubernetes() bool {
 	return false
 }
 
-func DetectJournald() bool {
-	paths := []string{
+func DetectJournald(cfg config.Config) bool {
+	paths := append([]string{}, cfg.JournaldDirs...)
+	paths = append(paths,
 		"/run/systemd/journal/socket",
 		"/var/run/systemd/journal/socket",
 		"/run/log/journal",
 		"/var/log/journal",
-	}
+	)
 
 	for _, path := range paths {
 		if _, err := os.Stat(path); err == nil {
@@ -57,9 +108,96 @@ func DetectJournald() bool {
 	return false
 }
 
-func StartCollectors() {
-	cfg := config.LoadConfigFromEnv()
+// DetectKmsg reports whether to read /dev/kmsg. In "auto" mode it is only
+// read where journald isn't running, since journald already records the
+// kernel log.
+func DetectKmsg(cfg config.Config, journald bool) bool {
+	switch cfg.KmsgMode {
+	case "false":
+		return false
+	case "auto":
+		if journald {
+			return false
+		}
+	}
+
+	if _, err := os.Stat(kmsg.DevicePath); err != nil {
+		log.Printf("[INFO] Kernel log not available at %s.", kmsg.DevicePath)
+		return false
+	}
+	log.Printf("[INFO] Detected kernel log at: %s", kmsg.DevicePath)
+	return true
+}
+
+// DetectAudit reports whether to tail auditd's log: in "auto" mode when the
+// log exists, and always when enabled explicitly, waiting for it to appear.
+func DetectAudit(cfg config.Config) bool {
+	if cfg.AuditMode == "false" {
+		return false
+	}
+	if _, err := os.Stat(cfg.AuditLogPath); err != nil {
+		if cfg.AuditMode == "auto" {
+			return false
+		}
+		log.Printf("[WARNING] Audit log %s not found yet: %v", cfg.AuditLogPath, err)
+		return true
+	}
+	log.Printf("[INFO] Detected audit log at: %s", cfg.AuditLogPath)
+	return true
+}
+
+// newOutputs creates the configured outputs that receive every entry in
+// addition to the Loggyto endpoint.
+func newOutputs(cfg config.Config) []outputs.Output {
+	var outs []outputs.Output
+	if cfg.ForwardOutputAddr != "" {
+		if fo, err := outputs.NewForwardOutput(cfg); err != nil {
+			log.Printf("[ERROR] Failed to create Forward output: %v", err)
+		} else {
+			outs = append(outs, fo)
+		}
+	}
+	if cfg.LokiURL != "" {
+		if lo, err := outputs.NewLokiOutput(cfg); err != nil {
+			log.Printf("[ERROR] Failed to create Loki output: %v", err)
+		} else {
+			outs = append(outs, lo)
+		}
+	}
+	if cfg.ElasticsearchURL != "" {
+		if eo, err := outputs.NewElasticsearchOutput(cfg); err != nil {
+			log.Printf("[ERROR] Failed to create Elasticsearch output: %v", err)
+		} else {
+			outs = append(outs, eo)
+		}
+	}
+	if cfg.SplunkHECURL != "" {
+		if so, err := outputs.NewSplunkOutput(cfg); err != nil {
+			log.Printf("[ERROR] Failed to create Splunk HEC output: %v", err)
+		} else {
+			outs = append(outs, so)
+		}
+	}
+	return outs
+}
+
+// closeOutputs delivers what the outputs still have queued and returns the
+// failures, so one-off runs can report entries that never arrived.
+func closeOutputs(outs []outputs.Output) error {
+	var errs []error
+	for _, o := range outs {
+		if err := o.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func newLogProcessor(cfg config.Config) (*processor.LogProcessor, []outputs.Output) {
 	s := sender.NewSender(cfg)
+	outs := newOutputs(cfg)
+	// The endpoint is optional once another output is configured.
+	useSender := cfg.Endpoint != "" || len(outs) == 0
 
 	dedup := utils.NewMessageCache(15 * time.Second)
 	redactor := pipeline.NewRedactor()
@@ -79,33 +217,76 @@ func StartCollectors() {
 		pipeline.DetectLogLevel,
 		pipeline.TryExtractTimestamp,
 		classifier,
+		// An entry one output could not take counts as undelivered, so
+		// collectors keep it before their checkpoints and send it again.
 		func(entry *pipeline.LogEntry) error {
-			return s.Send(logentry.LogEntry{
-				Message:           entry.Message,
-				Classification:    entry.Classification,
-				Timestamp:         entry.Timestamp.Format(time.RFC3339),
-				Level:             entry.Level,
-				MessageId:         entry.MessageId,
-				Labels:            entry.Labels,
-				TimestampInferred: entry.TimestampInferred,
-			})
+			var errs []error
+			for _, o := range outs {
+				if err := o.Write(entry); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if useSender {
+				errs = append(errs, s.Send(logentry.LogEntry{
+					Message:           entry.Message,
+					Classification:    entry.Classification,
+					Timestamp:         entry.Timestamp.Format(time.RFC3339),
+					Level:             entry.Level,
+					MessageId:         entry.MessageId,
+					Labels:            entry.Labels,
+					TimestampInferred: entry.TimestampInferred,
+				}))
+			}
+			return errors.Join(errs...)
 		},
 	)
 
-	logProcessor := processor.NewLogProcessor(p)
+	return processor.NewLogProcessor(p), outs
+}
+
+func StartCollectors() {
+	cfg := config.LoadConfigFromEnv()
+	logProcessor, outs := newLogProcessor(cfg)
+	defer closeOutputs(outs)
+	containers := utils.NewContainerRegistry()
 
 	var collectors []Collector
+	reporters := map[string]StatusReporter{}
+
+	journaldDetected := DetectJournald(cfg)
 
-	if DetectDocker() {
-		collectors = append(collectors, docker.NewContainerCollector(logProcessor, cfg))
+	for _, endpoint := range DetectDocker(cfg) {
+		dc := docker.NewContainerCollector(logProcessor, cfg, containers, endpoint, journaldDetected)
+		collectors = append(collectors, dc)
+		reporters["docker:"+endpoint] = dc
 	}
 
 	if DetectKubernetes() {
-		collectors = append(collectors, kubernetes.NewKubernetesCollector(logProcessor))
+		collectors = append(collectors, kubernetes.NewKubernetesCollector(logProcessor, cfg))
+	}
+
+	if journaldDetected {
+		collectors = append(collectors, journald.NewJournaldCollector(logProcessor, cfg, containers))
+	}
+
+	if DetectKmsg(cfg, journaldDetected) {
+		collectors = append(collectors, kmsg.NewKmsgCollector(logProcessor, cfg))
+	}
+
+	if DetectAudit(cfg) {
+		collectors = append(collectors, audit.NewAuditCollector(logProcessor, cfg))
 	}
 
-	if DetectJournald() {
-		collectors = append(collectors, journald.NewJournaldCollector(logProcessor))
+	if len(cfg.ExecCommands) > 0 {
+		collectors = append(collectors, command.NewCommandCollector(logProcessor, cfg))
+	}
+
+	if cfg.ForwardAddr != "" || cfg.ForwardSocket != "" {
+		collectors = append(collectors, fluentforward.NewForwardCollector(logProcessor, cfg))
+	}
+
+	if cfg.JournalRemoteAddr != "" {
+		collectors = append(collectors, journald.NewJournalRemoteCollector(logProcessor, cfg, containers))
 	}
 
 	if len(collectors) == 0 {
@@ -113,6 +294,39 @@ func StartCollectors() {
 		return
 	}
 
+	if cfg.StatusAddr != "" {
+		startStatusServer(cfg.StatusAddr, reporters)
+	}
+
+	runCollectors(collectors)
+}
+
+// StartLogDriverPlugin runs the agent as a Docker logging driver plugin
+// instead of detecting and polling the local environment.
+func StartLogDriverPlugin() {
+	cfg := config.LoadConfigFromEnv()
+	logProcessor, outs := newLogProcessor(cfg)
+	defer closeOutputs(outs)
+
+	runCollectors([]Collector{dockerplugin.NewLogDriverPlugin(logProcessor, cfg)})
+}
+
+// Ship sends standard input through the pipeline until EOF, bypassing
+// environment detection, for ad-hoc use like `some-tool | log-agent ship`.
+func Ship(labels map[string]string) error {
+	cfg := config.LoadConfigFromEnv()
+	logProcessor, outs := newLogProcessor(cfg)
+
+	// Run only sees whether entries were queued; what the outputs failed to
+	// deliver comes out when they close.
+	err := stdin.NewStdinCollector(logProcessor, cfg, os.Stdin, labels).Run()
+	if closeErr := closeOutputs(outs); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func runCollectors(collectors []Collector) {
 	log.Printf("[INFO] Starting %d collectors...", len(collectors))
 	for _, c := range collectors {
 		go c.Start()
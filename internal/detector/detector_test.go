@@ -0,0 +1,91 @@
+package detector
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"log-agent/internal/config"
+)
+
+// listenUnix creates a real socket at path, closed when the test ends.
+func listenUnix(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+}
+
+func TestDetectDockerPrefersConfiguredHosts(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix:///from/env.sock")
+
+	cfg := config.Config{DockerHosts: []string{"tcp://10.0.0.5:2376", "unix:///run/podman/podman.sock"}}
+	if got := DetectDocker(cfg); !reflect.DeepEqual(got, cfg.DockerHosts) {
+		t.Errorf("DetectDocker() = %v, want the configured hosts %v", got, cfg.DockerHosts)
+	}
+}
+
+func TestDetectDockerUsesDockerHost(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+
+	want := []string{"tcp://127.0.0.1:2375"}
+	if got := DetectDocker(config.Config{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("DetectDocker() = %v, want %v", got, want)
+	}
+}
+
+func TestDetectDockerFindsRootlessPodman(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+	listenUnix(t, socket)
+
+	found := false
+	for _, endpoint := range DetectDocker(config.Config{}) {
+		if endpoint == "unix://"+socket {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("DetectDocker() did not find the rootless Podman socket %s", socket)
+	}
+}
+
+func TestDetectSocketsSkipsSymlinkedDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	podman := filepath.Join(dir, "podman", "podman.sock")
+	docker := filepath.Join(dir, "docker.sock")
+	listenUnix(t, podman)
+	if err := os.Symlink(podman, docker); err != nil {
+		t.Fatal(err)
+	}
+
+	got := detectSockets([]string{docker, podman, filepath.Join(dir, "missing.sock")})
+	want := []string{"unix://" + docker}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectSockets() = %v, want %v", got, want)
+	}
+}
+
+func TestDetectSocketsKeepsDistinctSockets(t *testing.T) {
+	dir := t.TempDir()
+	docker := filepath.Join(dir, "docker.sock")
+	podman := filepath.Join(dir, "podman", "podman.sock")
+	listenUnix(t, docker)
+	listenUnix(t, podman)
+
+	got := detectSockets([]string{docker, podman})
+	want := []string{"unix://" + docker, "unix://" + podman}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectSockets() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package detector
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// StatusReporter is implemented by collectors that expose their internal
+// state through the agent's status endpoint.
+type StatusReporter interface {
+	Status() any
+}
+
+func startStatusServer(addr string, reporters map[string]StatusReporter) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		status := make(map[string]any, len(reporters))
+		for name, reporter := range reporters {
+			status[name] = reporter.Status()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("[ERROR] Failed to write status response: %v", err)
+		}
+	})
+
+	go func() {
+		log.Printf("[INFO] Status endpoint listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("[ERROR] Status endpoint stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package fluent
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// eventTimeExt is the MessagePack extension type Fluentd uses for
+// nanosecond-precision timestamps.
+const eventTimeExt = 0
+
+// EventTime is encoded as extension type 0 holding big-endian 32-bit seconds
+// and nanoseconds.
+type EventTime struct {
+	time.Time
+}
+
+func init() {
+	msgpack.RegisterExt(eventTimeExt, (*EventTime)(nil))
+}
+
+func (t *EventTime) MarshalMsgpack() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	return b, nil
+}
+
+func (t *EventTime) UnmarshalMsgpack(b []byte) error {
+	if len(b) != 8 {
+		return errors.New("fluent: EventTime must be 8 bytes")
+	}
+	sec := binary.BigEndian.Uint32(b)
+	nsec := binary.BigEndian.Uint32(b[4:])
+	t.Time = time.Unix(int64(sec), int64(nsec)).UTC()
+	return nil
+}
+
+// ParseTime accepts the time forms Forward clients send: EventTime, integer
+// seconds and, from some clients, float seconds.
+func ParseTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case *EventTime:
+		return t.Time, true
+	case EventTime:
+		return t.Time, true
+	case int64:
+		return time.Unix(t, 0).UTC(), true
+	case uint64:
+		return time.Unix(int64(t), 0).UTC(), true
+	case float64:
+		sec := int64(t)
+		return time.Unix(sec, int64((t-float64(sec))*float64(time.Second))).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// Digest computes the hex SHA-512 digest used on both sides of the shared
+// key handshake: sha512(salt + hostname + nonce + sharedKey).
+func Digest(salt, hostname, nonce, sharedKey string) string {
+	sum := sha512.Sum512([]byte(salt + hostname + nonce + sharedKey))
+	return hex.EncodeToString(sum[:])
+}
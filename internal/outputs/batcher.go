@@ -0,0 +1,145 @@
+package outputs
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"log-agent/internal/pipeline"
+)
+
+const (
+	defaultQueueSize     = 10000
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+
+	maxFlushAttempts = 5
+	maxRetryBackoff  = 30 * time.Second
+)
+
+// flushFunc delivers a batch. On failure it returns the entries worth
+// retrying, which may be fewer than it was given when the destination
+// accepted part of the batch or some entries can never be delivered.
+type flushFunc func(batch []pipeline.LogEntry) ([]pipeline.LogEntry, error)
+
+// batcher queues entries for an output and flushes them from a single
+// goroutine once batchSize entries are queued or every flushInterval.
+type batcher struct {
+	name string
+
+	// mu guards sending on entries against close, since collectors that
+	// outlive their Stop may still write while the output shuts down.
+	mu            sync.RWMutex
+	closed        bool
+	entries       chan pipeline.LogEntry
+	flush         flushFunc
+	batchSize     int
+	flushInterval time.Duration
+	done          chan struct{}
+
+	// dropped counts the entries given up on. Only run writes it, and close
+	// reads it after run has finished.
+	dropped int
+}
+
+func newBatcher(name string, batchSize int, flushInterval time.Duration, flush flushFunc) *batcher {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	b := &batcher{
+		name:          name,
+		entries:       make(chan pipeline.LogEntry, defaultQueueSize),
+		flush:         flush,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues a copy of the entry, failing instead of blocking when the
+// destination has fallen too far behind or the output is closed.
+func (b *batcher) add(entry *pipeline.LogEntry) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return fmt.Errorf("%s output is closed", b.name)
+	}
+	select {
+	case b.entries <- *entry:
+		return nil
+	default:
+		return fmt.Errorf("%s output queue is full", b.name)
+	}
+}
+
+// close flushes what is queued, waits for delivery to finish and reports
+// whether any entry was dropped since the batcher started.
+func (b *batcher) close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.entries)
+	}
+	b.mu.Unlock()
+	<-b.done
+	if b.dropped > 0 {
+		return fmt.Errorf("%s output dropped %d entries", b.name, b.dropped)
+	}
+	return nil
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]pipeline.LogEntry, 0, b.batchSize)
+	for {
+		select {
+		case entry, ok := <-b.entries:
+			if !ok {
+				b.deliver(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < b.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		b.deliver(batch)
+		batch = batch[:0]
+	}
+}
+
+// deliver flushes a batch, retrying what failed with backoff before giving
+// up on it.
+func (b *batcher) deliver(batch []pipeline.LogEntry) {
+	backoff := time.Second
+	for attempt := 1; len(batch) > 0; attempt++ {
+		retry, err := b.flush(batch)
+		if err == nil {
+			return
+		}
+		if len(retry) == 0 {
+			log.Printf("[ERROR] %s output failed to deliver a batch: %v", b.name, err)
+			b.dropped += len(batch)
+			return
+		}
+		if attempt == maxFlushAttempts {
+			log.Printf("[ERROR] %s output dropped %d entries after %d attempts: %v", b.name, len(retry), attempt, err)
+			b.dropped += len(retry)
+			return
+		}
+		log.Printf("[WARNING] %s output failed to deliver %d entries, retrying in %s: %v", b.name, len(retry), backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRetryBackoff)
+		batch = retry
+	}
+}
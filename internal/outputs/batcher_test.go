@@ -0,0 +1,57 @@
+package outputs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"log-agent/internal/pipeline"
+)
+
+func TestBatcherAddAfterClose(t *testing.T) {
+	var mu sync.Mutex
+	delivered := 0
+	b := newBatcher("Test", 10, time.Millisecond, func(batch []pipeline.LogEntry) ([]pipeline.LogEntry, error) {
+		mu.Lock()
+		delivered += len(batch)
+		mu.Unlock()
+		return nil, nil
+	})
+
+	// Writers that outlive their collector's Stop keep adding while the
+	// output closes.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					b.add(testEntry("late", nil))
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := b.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if err := b.add(testEntry("after close", nil)); err == nil {
+		t.Error("add after close succeeded, want an error")
+	}
+	if err := b.close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if delivered == 0 {
+		t.Error("nothing was delivered before close")
+	}
+}
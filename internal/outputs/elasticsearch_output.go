@@ -0,0 +1,284 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+)
+
+const (
+	defaultElasticsearchIndex      = "loggyto-%Y.%m.%d"
+	defaultElasticsearchDataStream = "logs-loggyto-default"
+)
+
+// ElasticsearchOutput indexes entries through the _bulk API of Elasticsearch
+// or OpenSearch. Each entry's MessageId is its document _id, so a retried
+// request never indexes an entry twice.
+type ElasticsearchOutput struct {
+	url             string
+	index           *tagTemplate
+	dataStream      bool
+	deadLetterIndex string
+	username        string
+	password        string
+	apiKey          string
+	client          *http.Client
+	batcher         *batcher
+}
+
+type elasticsearchDocument struct {
+	Timestamp         string            `json:"@timestamp"`
+	Message           string            `json:"message"`
+	Level             string            `json:"level"`
+	Classification    string            `json:"classification"`
+	MessageId         string            `json:"message_id"`
+	TimestampInferred bool              `json:"timestamp_inferred"`
+	Labels            map[string]string `json:"labels"`
+}
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+type bulkStatusError struct {
+	code int
+	body string
+}
+
+func (e *bulkStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d: %s", e.code, e.body)
+}
+
+func NewElasticsearchOutput(cfg config.Config) (*ElasticsearchOutput, error) {
+	index := cfg.ElasticsearchIndex
+	if index == "" {
+		index = defaultElasticsearchIndex
+		if cfg.ElasticsearchDataStream {
+			index = defaultElasticsearchDataStream
+		}
+	}
+
+	eo := &ElasticsearchOutput{
+		url:             strings.TrimSuffix(cfg.ElasticsearchURL, "/") + "/_bulk",
+		index:           parseTagTemplate(index),
+		dataStream:      cfg.ElasticsearchDataStream,
+		deadLetterIndex: cfg.ElasticsearchDeadLetter,
+		username:        cfg.ElasticsearchUsername,
+		password:        cfg.ElasticsearchPassword,
+		apiKey:          cfg.ElasticsearchAPIKey,
+		client:          &http.Client{Timeout: 30 * time.Second},
+	}
+	eo.batcher = newBatcher("Elasticsearch", cfg.OutputBatchSize, cfg.OutputFlushInterval, eo.flush)
+	return eo, nil
+}
+
+func (eo *ElasticsearchOutput) Write(entry *pipeline.LogEntry) error {
+	return eo.batcher.add(entry)
+}
+
+func (eo *ElasticsearchOutput) Close() error {
+	return eo.batcher.close()
+}
+
+// flush sends a batch and sorts the per-item results: rejected items that
+// may succeed later are returned for retry, and items the index can never
+// accept, such as mapping conflicts, go to the dead-letter index.
+func (eo *ElasticsearchOutput) flush(batch []pipeline.LogEntry) ([]pipeline.LogEntry, error) {
+	var body bytes.Buffer
+	for _, entry := range batch {
+		if err := eo.appendAction(&body, eo.indexName(&entry), &entry); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := eo.bulk(body.Bytes())
+	var statusErr *bulkStatusError
+	if errors.As(err, &statusErr) && statusErr.code != http.StatusTooManyRequests && statusErr.code < 500 {
+		return nil, err
+	}
+	if err != nil {
+		return batch, err
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+	if len(resp.Items) != len(batch) {
+		return batch, fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(batch))
+	}
+
+	var retry []pipeline.LogEntry
+	var deadLetters bytes.Buffer
+	var firstErr string
+	for i, item := range resp.Items {
+		var result bulkItemResult
+		for _, r := range item {
+			result = r
+		}
+		switch {
+		case result.Status < 300:
+		case result.Status == http.StatusConflict && eo.dataStream:
+			// Created by an earlier attempt whose response was lost.
+		case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+			retry = append(retry, batch[i])
+			if firstErr == "" && result.Error != nil {
+				firstErr = result.Error.Type + ": " + result.Error.Reason
+			}
+		default:
+			reason := fmt.Sprintf("status %d", result.Status)
+			if result.Error != nil {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			eo.appendDeadLetter(&deadLetters, &batch[i], result.Index, reason)
+		}
+	}
+
+	if deadLetters.Len() > 0 {
+		eo.sendDeadLetters(deadLetters.Bytes())
+	}
+	if len(retry) > 0 {
+		return retry, fmt.Errorf("%d documents rejected: %s", len(retry), firstErr)
+	}
+	return nil, nil
+}
+
+// appendAction adds one action and document pair. Data streams only accept
+// "create".
+func (eo *ElasticsearchOutput) appendAction(body *bytes.Buffer, index string, entry *pipeline.LogEntry) error {
+	op := "index"
+	if eo.dataStream {
+		op = "create"
+	}
+	meta := map[string]string{"_index": index}
+	if entry.MessageId != "" {
+		meta["_id"] = entry.MessageId
+	}
+	action, err := json.Marshal(map[string]map[string]string{op: meta})
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(elasticsearchDocument{
+		Timestamp:         entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Message:           entry.Message,
+		Level:             entry.Level,
+		Classification:    entry.Classification,
+		MessageId:         entry.MessageId,
+		TimestampInferred: entry.TimestampInferred,
+		Labels:            entry.Labels,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+	body.Write(action)
+	body.WriteByte('\n')
+	body.Write(doc)
+	body.WriteByte('\n')
+	return nil
+}
+
+// appendDeadLetter wraps a rejected document so it keeps the original as
+// plain text, which no mapping can reject.
+func (eo *ElasticsearchOutput) appendDeadLetter(body *bytes.Buffer, entry *pipeline.LogEntry, index, reason string) {
+	if eo.deadLetterIndex == "" {
+		log.Printf("[WARNING] Elasticsearch rejected document %s for %s: %s", entry.MessageId, index, reason)
+		return
+	}
+	original, _ := json.Marshal(entry)
+	action, _ := json.Marshal(map[string]map[string]string{
+		"create": {"_index": eo.deadLetterIndex, "_id": entry.MessageId},
+	})
+	doc, _ := json.Marshal(map[string]string{
+		"@timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		"index":      index,
+		"error":      reason,
+		"document":   string(original),
+	})
+	body.Write(action)
+	body.WriteByte('\n')
+	body.Write(doc)
+	body.WriteByte('\n')
+}
+
+func (eo *ElasticsearchOutput) sendDeadLetters(body []byte) {
+	resp, err := eo.bulk(body)
+	if err != nil {
+		log.Printf("[ERROR] Failed to write Elasticsearch dead letters to %s: %v", eo.deadLetterIndex, err)
+		return
+	}
+	failed := 0
+	for _, item := range resp.Items {
+		for _, r := range item {
+			if r.Status >= 300 && r.Status != http.StatusConflict {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		log.Printf("[ERROR] Dropped %d documents that %s also rejected.", failed, eo.deadLetterIndex)
+	} else {
+		log.Printf("[WARNING] Moved %d rejected documents to %s.", len(resp.Items), eo.deadLetterIndex)
+	}
+}
+
+func (eo *ElasticsearchOutput) bulk(body []byte) (*bulkResponse, error) {
+	req, err := http.NewRequest("POST", eo.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case eo.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+eo.apiKey)
+	case eo.username != "":
+		req.SetBasicAuth(eo.username, eo.password)
+	}
+
+	resp, err := eo.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &bulkStatusError{code: resp.StatusCode, body: strings.TrimSpace(string(respBody))}
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding bulk response: %w", err)
+	}
+	return &result, nil
+}
+
+// indexName expands the index template: {label} placeholders and the
+// %Y, %m, %d and %H directives, taken from the entry's time in UTC. Index
+// names must be lowercase.
+func (eo *ElasticsearchOutput) indexName(entry *pipeline.LogEntry) string {
+	ts := entry.Timestamp.UTC()
+	name := strings.NewReplacer(
+		"%Y", fmt.Sprintf("%04d", ts.Year()),
+		"%m", fmt.Sprintf("%02d", ts.Month()),
+		"%d", fmt.Sprintf("%02d", ts.Day()),
+		"%H", fmt.Sprintf("%02d", ts.Hour()),
+	).Replace(eo.index.expand(entry.Labels))
+	return strings.ToLower(name)
+}
@@ -0,0 +1,290 @@
+package outputs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/fluent"
+	"log-agent/internal/pipeline"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	forwardDialTimeout = 10 * time.Second
+	forwardAckTimeout  = 30 * time.Second
+)
+
+// ForwardOutput sends entries to a Fluentd or Fluent Bit server over the
+// Forward protocol, as PackedForward messages with one message per tag.
+type ForwardOutput struct {
+	addr       string
+	tag        *tagTemplate
+	sharedKey  string
+	requireAck bool
+	tlsConfig  *tls.Config
+	hostname   string
+	batcher    *batcher
+
+	// conn and its codec are only used from the batcher's goroutine.
+	conn net.Conn
+	enc  *msgpack.Encoder
+	dec  *msgpack.Decoder
+}
+
+func NewForwardOutput(cfg config.Config) (*ForwardOutput, error) {
+	hostname, _ := os.Hostname()
+	fo := &ForwardOutput{
+		addr:       cfg.ForwardOutputAddr,
+		tag:        parseTagTemplate(cfg.ForwardOutputTag),
+		sharedKey:  cfg.ForwardOutputSharedKey,
+		requireAck: cfg.ForwardOutputRequireAck,
+		hostname:   hostname,
+	}
+	if cfg.ForwardOutputTLS {
+		tlsConfig, err := newTLSConfig(cfg.ForwardOutputTLSCA, cfg.ForwardOutputTLSInsecure)
+		if err != nil {
+			return nil, err
+		}
+		fo.tlsConfig = tlsConfig
+	}
+	fo.batcher = newBatcher("Forward", cfg.OutputBatchSize, cfg.OutputFlushInterval, fo.flush)
+	return fo, nil
+}
+
+func (fo *ForwardOutput) Write(entry *pipeline.LogEntry) error {
+	return fo.batcher.add(entry)
+}
+
+func (fo *ForwardOutput) Close() error {
+	err := fo.batcher.close()
+	fo.disconnect()
+	return err
+}
+
+// flush sends one PackedForward message per tag. With require-ack each
+// message waits for its chunk to be acknowledged; anything not yet
+// acknowledged is returned for retransmission on a new connection.
+func (fo *ForwardOutput) flush(batch []pipeline.LogEntry) ([]pipeline.LogEntry, error) {
+	tags, groups := fo.groupByTag(batch)
+
+	for i, tag := range tags {
+		if err := fo.send(tag, groups[tag]); err != nil {
+			fo.disconnect()
+			var retry []pipeline.LogEntry
+			for _, t := range tags[i:] {
+				retry = append(retry, groups[t]...)
+			}
+			return retry, err
+		}
+	}
+	return nil, nil
+}
+
+func (fo *ForwardOutput) groupByTag(batch []pipeline.LogEntry) ([]string, map[string][]pipeline.LogEntry) {
+	var tags []string
+	groups := make(map[string][]pipeline.LogEntry)
+	for _, entry := range batch {
+		tag := fo.tag.expand(entry.Labels)
+		if _, ok := groups[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		groups[tag] = append(groups[tag], entry)
+	}
+	return tags, groups
+}
+
+func (fo *ForwardOutput) send(tag string, entries []pipeline.LogEntry) error {
+	var packed bytes.Buffer
+	enc := msgpack.NewEncoder(&packed)
+	for _, entry := range entries {
+		ts := fluent.EventTime{Time: entry.Timestamp}
+		if err := enc.Encode([]interface{}{&ts, forwardRecord(&entry)}); err != nil {
+			return fmt.Errorf("encoding entry: %w", err)
+		}
+	}
+
+	if fo.conn == nil {
+		if err := fo.connect(); err != nil {
+			return err
+		}
+	}
+
+	option := map[string]interface{}{"size": len(entries)}
+	chunk := ""
+	if fo.requireAck {
+		chunk = newChunkID()
+		option["chunk"] = chunk
+	}
+
+	fo.conn.SetDeadline(time.Now().Add(forwardAckTimeout))
+	defer fo.conn.SetDeadline(time.Time{})
+
+	if err := fo.enc.Encode([]interface{}{tag, packed.Bytes(), option}); err != nil {
+		return fmt.Errorf("sending to %s: %w", fo.addr, err)
+	}
+	if !fo.requireAck {
+		return nil
+	}
+
+	var resp map[string]interface{}
+	if err := fo.dec.Decode(&resp); err != nil {
+		return fmt.Errorf("waiting for ack from %s: %w", fo.addr, err)
+	}
+	if ack, _ := resp["ack"].(string); ack != chunk {
+		return fmt.Errorf("unexpected ack %q from %s", ack, fo.addr)
+	}
+	return nil
+}
+
+func (fo *ForwardOutput) connect() error {
+	dialer := &net.Dialer{Timeout: forwardDialTimeout}
+	var conn net.Conn
+	var err error
+	if fo.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", fo.addr, fo.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", fo.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", fo.addr, err)
+	}
+
+	fo.conn = conn
+	fo.enc = msgpack.NewEncoder(conn)
+	fo.dec = msgpack.NewDecoder(conn)
+	fo.dec.UseLooseInterfaceDecoding(true)
+
+	if fo.sharedKey != "" {
+		conn.SetDeadline(time.Now().Add(forwardDialTimeout))
+		err := fo.handshake()
+		conn.SetDeadline(time.Time{})
+		if err != nil {
+			fo.disconnect()
+			return fmt.Errorf("handshake with %s: %w", fo.addr, err)
+		}
+	}
+	log.Printf("[INFO] Forward output connected to %s", fo.addr)
+	return nil
+}
+
+func (fo *ForwardOutput) disconnect() {
+	if fo.conn != nil {
+		fo.conn.Close()
+		fo.conn, fo.enc, fo.dec = nil, nil, nil
+	}
+}
+
+// handshake answers the server's HELO with a PING proving the shared key and
+// checks that the PONG proves it back.
+func (fo *ForwardOutput) handshake() error {
+	v, err := fo.dec.DecodeInterface()
+	if err != nil {
+		return err
+	}
+	helo, ok := v.([]interface{})
+	if !ok || len(helo) < 2 || helo[0] != "HELO" {
+		return errors.New("expected HELO")
+	}
+	options, _ := helo[1].(map[string]interface{})
+	nonce, _ := options["nonce"].(string)
+	if auth, _ := options["auth"].(string); auth != "" {
+		return errors.New("server requires user authentication")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	saltHex := hex.EncodeToString(salt)
+	ping := []interface{}{"PING", fo.hostname, saltHex, fluent.Digest(saltHex, fo.hostname, nonce, fo.sharedKey), "", ""}
+	if err := fo.enc.Encode(ping); err != nil {
+		return err
+	}
+
+	if v, err = fo.dec.DecodeInterface(); err != nil {
+		return err
+	}
+	pong, ok := v.([]interface{})
+	if !ok || len(pong) < 5 || pong[0] != "PONG" {
+		return errors.New("expected PONG")
+	}
+	if authenticated, _ := pong[1].(bool); !authenticated {
+		reason, _ := pong[2].(string)
+		return fmt.Errorf("rejected: %s", reason)
+	}
+	serverHostname, _ := pong[3].(string)
+	digest, _ := pong[4].(string)
+	if digest != fluent.Digest(saltHex, serverHostname, nonce, fo.sharedKey) {
+		return errors.New("server digest mismatch")
+	}
+	return nil
+}
+
+// forwardRecord flattens an entry into a Fluentd record: labels become
+// top-level fields next to the message.
+func forwardRecord(entry *pipeline.LogEntry) map[string]string {
+	record := make(map[string]string, len(entry.Labels)+4)
+	for k, v := range entry.Labels {
+		record[k] = v
+	}
+	record["message"] = entry.Message
+	record["level"] = entry.Level
+	record["classification"] = entry.Classification
+	record["message_id"] = entry.MessageId
+	return record
+}
+
+func newChunkID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// tagTemplate builds a tag from labels, e.g. "k8s.{namespace}.{container_name}".
+type tagTemplate struct {
+	parts []string // literals at even indexes, label names at odd ones
+}
+
+func parseTagTemplate(template string) *tagTemplate {
+	t := &tagTemplate{}
+	for {
+		start := strings.IndexByte(template, '{')
+		end := strings.IndexByte(template[start+1:], '}')
+		if start < 0 || end < 0 {
+			t.parts = append(t.parts, template)
+			return t
+		}
+		t.parts = append(t.parts, template[:start], template[start+1:start+1+end])
+		template = template[start+2+end:]
+	}
+}
+
+// expand fills in the labels, using "unknown" for missing ones so tags keep
+// their shape for routing.
+func (t *tagTemplate) expand(labels map[string]string) string {
+	var sb strings.Builder
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			sb.WriteString(part)
+			continue
+		}
+		value := labels[part]
+		if value == "" {
+			value = "unknown"
+		}
+		sb.WriteString(value)
+	}
+	return sb.String()
+}
@@ -0,0 +1,466 @@
+package outputs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"log-agent/internal/collector/fluentforward"
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+	"log-agent/internal/processor"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// forwardInput runs the agent's own Forward input, so the output is tested
+// against the real receiving end of the protocol. The first failDeliveries
+// entries it receives fail to deliver, which leaves their chunk
+// unacknowledged.
+type forwardInput struct {
+	t         *testing.T
+	cfg       config.Config
+	collector *fluentforward.ForwardCollector
+	failed    chan struct{}
+
+	mu             sync.Mutex
+	failDeliveries int
+	attempts       int
+	entries        []*pipeline.LogEntry
+}
+
+func newForwardInput(t *testing.T, sharedKey string) *forwardInput {
+	t.Helper()
+	// Reserve a free port; the input may be restarted on it.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	in := &forwardInput{
+		t:      t,
+		cfg:    config.Config{ForwardAddr: addr, ForwardSharedKey: sharedKey},
+		failed: make(chan struct{}, 1),
+	}
+	in.start()
+	t.Cleanup(func() { in.collector.Stop() })
+	return in
+}
+
+func (in *forwardInput) start() {
+	p := pipeline.NewPipeline(
+		func(raw string) []string { return []string{raw} },
+		func(line string) string { return line },
+		func(string) bool { return true },
+		func(line string) string { return line },
+		func(string) string { return "" },
+		func(string) (time.Time, bool) { return time.Time{}, false },
+		func(string) string { return "" },
+		in.deliver,
+	)
+	in.collector = fluentforward.NewForwardCollector(processor.NewLogProcessor(p), in.cfg)
+	in.collector.Start()
+}
+
+// restart stops the input, dropping its connections, and starts it again on
+// the same address.
+func (in *forwardInput) restart() {
+	in.collector.Stop()
+	in.start()
+}
+
+func (in *forwardInput) deliver(entry *pipeline.LogEntry) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.attempts++
+	if in.failDeliveries > 0 {
+		in.failDeliveries--
+		select {
+		case in.failed <- struct{}{}:
+		default:
+		}
+		return errors.New("destination unavailable")
+	}
+	in.entries = append(in.entries, entry)
+	return nil
+}
+
+func (in *forwardInput) received() []*pipeline.LogEntry {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]*pipeline.LogEntry(nil), in.entries...)
+}
+
+// waitFor waits until the input has delivered n entries.
+func (in *forwardInput) waitFor(n int) []*pipeline.LogEntry {
+	in.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(in.received()) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries := in.received()
+	if len(entries) != n {
+		in.t.Fatalf("input delivered %d entries, want %d", len(entries), n)
+	}
+	return entries
+}
+
+// forwardRelay passes connections from a listener on to the input and
+// records what clients send, so tests can check the wire format.
+type forwardRelay struct {
+	mu   sync.Mutex
+	sent bytes.Buffer
+}
+
+func startRelay(t *testing.T, l net.Listener, target string) *forwardRelay {
+	t.Helper()
+	r := &forwardRelay{}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(conn, upstream)
+				io.Copy(upstream, io.TeeReader(conn, r))
+			}()
+		}
+	}()
+	return r
+}
+
+func (r *forwardRelay) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sent.Write(p)
+}
+
+// messages decodes the Forward messages clients sent so far.
+func (r *forwardRelay) messages() [][]interface{} {
+	r.mu.Lock()
+	dec := msgpack.NewDecoder(bytes.NewReader(r.sent.Bytes()))
+	r.mu.Unlock()
+	dec.UseLooseInterfaceDecoding(true)
+
+	var msgs [][]interface{}
+	for {
+		v, err := dec.DecodeInterface()
+		if err != nil {
+			return msgs
+		}
+		msg, _ := v.([]interface{})
+		msgs = append(msgs, msg)
+	}
+}
+
+func forwardTestConfig(addr string) config.Config {
+	return config.Config{
+		ForwardOutputAddr:       addr,
+		ForwardOutputTag:        "loggyto",
+		ForwardOutputRequireAck: true,
+		OutputFlushInterval:     10 * time.Millisecond,
+	}
+}
+
+func testEntry(message string, labels map[string]string) *pipeline.LogEntry {
+	return &pipeline.LogEntry{
+		Message:   message,
+		Level:     "info",
+		Timestamp: time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC),
+		MessageId: "id-" + message,
+		Labels:    labels,
+	}
+}
+
+func writeEntries(t *testing.T, fo *ForwardOutput, entries ...*pipeline.LogEntry) {
+	t.Helper()
+	for _, entry := range entries {
+		if err := fo.Write(entry); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+}
+
+func TestForwardOutputSendsPackedForward(t *testing.T) {
+	in := newForwardInput(t, "")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := startRelay(t, l, in.cfg.ForwardAddr)
+
+	cfg := forwardTestConfig(l.Addr().String())
+	cfg.OutputFlushInterval = time.Hour
+	fo, err := NewForwardOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, fo,
+		testEntry("first", map[string]string{"container_name": "web"}),
+		testEntry("second", map[string]string{"container_name": "web"}),
+	)
+	if err := fo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	msgs := relay.messages()
+	if len(msgs) != 1 || len(msgs[0]) != 3 {
+		t.Fatalf("sent %v, want one [tag, entries, option] message", msgs)
+	}
+	if _, ok := msgs[0][1].(string); !ok {
+		t.Errorf("entries are %T, want PackedForward binary", msgs[0][1])
+	}
+	option, _ := msgs[0][2].(map[string]interface{})
+	if size, _ := option["size"].(int64); size != 2 {
+		t.Errorf("option size = %v, want 2", option["size"])
+	}
+	if chunk, _ := option["chunk"].(string); chunk == "" {
+		t.Error("option has no chunk id although acks are required")
+	}
+
+	for i, entry := range in.waitFor(2) {
+		want := []string{"first", "second"}[i]
+		if entry.Message != want || entry.Labels["tag"] != "loggyto" || entry.Labels["container_name"] != "web" || entry.Labels["message_id"] != "id-"+want {
+			t.Errorf("entry %d = %+v", i, entry)
+		}
+		if !entry.Timestamp.Equal(testEntry(want, nil).Timestamp) {
+			t.Errorf("entry %d time = %v, want nanosecond EventTime", i, entry.Timestamp)
+		}
+	}
+}
+
+func TestForwardOutputWithoutAck(t *testing.T) {
+	in := newForwardInput(t, "")
+
+	cfg := forwardTestConfig(in.cfg.ForwardAddr)
+	cfg.ForwardOutputRequireAck = false
+	fo, err := NewForwardOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, fo, testEntry("fire and forget", nil))
+	if err := fo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	in.waitFor(1)
+}
+
+func TestForwardOutputRetransmitsUnacknowledgedChunk(t *testing.T) {
+	in := newForwardInput(t, "")
+	in.failDeliveries = 1
+
+	fo, err := NewForwardOutput(forwardTestConfig(in.cfg.ForwardAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, fo, testEntry("must arrive", nil))
+
+	// The input doesn't ack the chunk it failed to deliver; dropping the
+	// connection makes the output send it again.
+	select {
+	case <-in.failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the chunk never reached the input")
+	}
+	in.restart()
+
+	if err := fo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	entries := in.waitFor(1)
+	if entries[0].Message != "must arrive" {
+		t.Errorf("delivered %q", entries[0].Message)
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.attempts != 2 {
+		t.Errorf("input saw the entry %d times, want the chunk and its retransmission", in.attempts)
+	}
+}
+
+func TestForwardOutputSharedKeyHandshake(t *testing.T) {
+	in := newForwardInput(t, "secret")
+
+	cfg := forwardTestConfig(in.cfg.ForwardAddr)
+	cfg.ForwardOutputSharedKey = "secret"
+	fo, err := NewForwardOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, fo, testEntry("authenticated", nil))
+	if err := fo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	in.waitFor(1)
+}
+
+func TestForwardOutputHandshakeRejected(t *testing.T) {
+	in := newForwardInput(t, "secret")
+
+	fo := &ForwardOutput{addr: in.cfg.ForwardAddr, sharedKey: "wrong", hostname: "agent"}
+	err := fo.connect()
+	if err == nil || !strings.Contains(err.Error(), "rejected: shared key mismatch") {
+		t.Fatalf("connect() error = %v, want the input's rejection", err)
+	}
+	if fo.conn != nil {
+		t.Error("connection kept after a failed handshake")
+	}
+}
+
+func TestTagTemplateExpand(t *testing.T) {
+	labels := map[string]string{"namespace": "shop", "container_name": "web"}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"loggyto", "loggyto"},
+		{"k8s.{namespace}.{container_name}", "k8s.shop.web"},
+		{"{namespace}", "shop"},
+		{"docker.{container_id}", "docker.unknown"},
+		{"app.{namespace", "app.{namespace"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseTagTemplate(tt.template).expand(labels); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestForwardOutputGroupsEntriesByTag(t *testing.T) {
+	in := newForwardInput(t, "")
+
+	cfg := forwardTestConfig(in.cfg.ForwardAddr)
+	cfg.ForwardOutputTag = "docker.{container_name}"
+	cfg.OutputFlushInterval = time.Hour
+	fo, err := NewForwardOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, fo,
+		testEntry("a", map[string]string{"container_name": "web"}),
+		testEntry("b", map[string]string{"container_name": "db"}),
+		testEntry("c", map[string]string{"container_name": "web"}),
+	)
+	if err := fo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	tags := map[string]int{}
+	for _, entry := range in.waitFor(3) {
+		tags[entry.Labels["tag"]]++
+	}
+	if len(tags) != 2 || tags["docker.web"] != 2 || tags["docker.db"] != 1 {
+		t.Errorf("entries per tag = %v, want docker.web:2 docker.db:1", tags)
+	}
+}
+
+// writeTestCert creates a self-signed certificate for 127.0.0.1 and returns
+// it along with the path of its PEM file.
+func writeTestCert(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "forward-test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+// TestForwardOutputTLS terminates TLS in front of the input, as a TLS
+// enabled Fluentd or a stunnel would.
+func TestForwardOutputTLS(t *testing.T) {
+	in := newForwardInput(t, "secret")
+	cert, caFile := writeTestCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startRelay(t, l, in.cfg.ForwardAddr)
+
+	cfg := forwardTestConfig(l.Addr().String())
+	cfg.ForwardOutputTLS = true
+	cfg.ForwardOutputTLSCA = caFile
+	cfg.ForwardOutputSharedKey = "secret"
+	fo, err := NewForwardOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, fo, testEntry("encrypted", nil))
+	if err := fo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if entries := in.waitFor(1); entries[0].Message != "encrypted" {
+		t.Errorf("delivered %q, want the entry sent over TLS", entries[0].Message)
+	}
+}
+
+func TestForwardOutputTLSRejectsUnknownCA(t *testing.T) {
+	in := newForwardInput(t, "")
+	cert, _ := writeTestCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startRelay(t, l, in.cfg.ForwardAddr)
+
+	// A CA of its own, so the relay's certificate is not trusted.
+	_, otherCA := writeTestCert(t)
+	cfg := forwardTestConfig(l.Addr().String())
+	cfg.ForwardOutputTLS = true
+	cfg.ForwardOutputTLSCA = otherCA
+	fo, err := NewForwardOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fo.batcher.close()
+
+	var unknownAuthority x509.UnknownAuthorityError
+	if err := fo.connect(); !errors.As(err, &unknownAuthority) {
+		t.Errorf("connect() error = %v, want an unknown authority error", err)
+	}
+}
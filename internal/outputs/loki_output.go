@@ -0,0 +1,257 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiOutput pushes entries to Loki. Only the configured labels become
+// stream labels, since every distinct combination is a separate stream.
+type LokiOutput struct {
+	url      string
+	labels   []string
+	tenant   string
+	format   string
+	username string
+	password string
+	client   *http.Client
+	batcher  *batcher
+}
+
+type lokiStream struct {
+	labels  string
+	entries []pipeline.LogEntry
+}
+
+func NewLokiOutput(cfg config.Config) (*LokiOutput, error) {
+	if cfg.LokiFormat != "protobuf" && cfg.LokiFormat != "json" {
+		return nil, fmt.Errorf("unsupported Loki format %q", cfg.LokiFormat)
+	}
+	url := strings.TrimSuffix(cfg.LokiURL, "/")
+	if !strings.HasSuffix(url, lokiPushPath) {
+		url += lokiPushPath
+	}
+
+	lo := &LokiOutput{
+		url:      url,
+		labels:   cfg.LokiLabels,
+		tenant:   cfg.LokiTenant,
+		format:   cfg.LokiFormat,
+		username: cfg.LokiUsername,
+		password: cfg.LokiPassword,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+	lo.batcher = newBatcher("Loki", cfg.OutputBatchSize, cfg.OutputFlushInterval, lo.flush)
+	return lo, nil
+}
+
+func (lo *LokiOutput) Write(entry *pipeline.LogEntry) error {
+	return lo.batcher.add(entry)
+}
+
+func (lo *LokiOutput) Close() error {
+	return lo.batcher.close()
+}
+
+func (lo *LokiOutput) flush(batch []pipeline.LogEntry) ([]pipeline.LogEntry, error) {
+	streams := lo.groupStreams(batch)
+
+	var body []byte
+	var err error
+	if lo.format == "json" {
+		body, err = encodeLokiJSON(streams)
+	} else {
+		body = snappy.Encode(nil, encodeLokiProtobuf(streams))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding push request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", lo.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if lo.format == "json" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if lo.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", lo.tenant)
+	}
+	if lo.username != "" {
+		req.SetBasicAuth(lo.username, lo.password)
+	}
+
+	resp, err := lo.client.Do(req)
+	if err != nil {
+		return batch, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil, nil
+	case resp.StatusCode == http.StatusBadRequest && isLokiOrderingError(string(respBody)):
+		// Loki keeps the entries it accepted and rejects the rest for good,
+		// so resending the batch would only be rejected again.
+		log.Printf("[WARNING] Loki rejected out-of-order entries: %s", strings.TrimSpace(string(respBody)))
+		return nil, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return batch, fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
+
+// groupStreams splits a batch into streams, each sorted by timestamp since
+// Loki rejects entries older than the newest one it has for a stream unless
+// unordered writes are enabled.
+func (lo *LokiOutput) groupStreams(batch []pipeline.LogEntry) []*lokiStream {
+	var streams []*lokiStream
+	byLabels := make(map[string]*lokiStream)
+	for _, entry := range batch {
+		labels := lo.streamLabels(&entry)
+		stream, ok := byLabels[labels]
+		if !ok {
+			stream = &lokiStream{labels: labels}
+			byLabels[labels] = stream
+			streams = append(streams, stream)
+		}
+		stream.entries = append(stream.entries, entry)
+	}
+	for _, stream := range streams {
+		sort.SliceStable(stream.entries, func(i, j int) bool {
+			return stream.entries[i].Timestamp.Before(stream.entries[j].Timestamp)
+		})
+	}
+	return streams
+}
+
+// streamLabels renders the selected labels in Prometheus form, e.g.
+// {container_name="web", namespace="default"}. "level" falls back to the
+// entry's detected level.
+func (lo *LokiOutput) streamLabels(entry *pipeline.LogEntry) string {
+	pairs := make([]string, 0, len(lo.labels))
+	for _, name := range lo.labels {
+		value := entry.Labels[name]
+		if value == "" && name == "level" {
+			value = entry.Level
+		}
+		if value == "" {
+			continue
+		}
+		pairs = append(pairs, lokiLabelName(name)+"="+strconv.Quote(value))
+	}
+	if len(pairs) == 0 {
+		// Loki refuses streams without labels.
+		pairs = append(pairs, `job="loggyto"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// lokiLabelName replaces characters Prometheus label names don't allow.
+func lokiLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func isLokiOrderingError(body string) bool {
+	return strings.Contains(body, "out of order") ||
+		strings.Contains(body, "too far behind") ||
+		strings.Contains(body, "too old")
+}
+
+// encodeLokiProtobuf encodes a logproto.PushRequest:
+//
+//	PushRequest  { repeated Stream streams = 1; }
+//	Stream       { string labels = 1; repeated Entry entries = 2; }
+//	Entry        { Timestamp timestamp = 1; string line = 2; }
+//	Timestamp    { int64 seconds = 1; int32 nanos = 2; }
+func encodeLokiProtobuf(streams []*lokiStream) []byte {
+	var req []byte
+	for _, stream := range streams {
+		var s []byte
+		s = protowire.AppendTag(s, 1, protowire.BytesType)
+		s = protowire.AppendString(s, stream.labels)
+		for _, entry := range stream.entries {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(entry.Timestamp.Unix()))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(entry.Timestamp.Nanosecond()))
+
+			var e []byte
+			e = protowire.AppendTag(e, 1, protowire.BytesType)
+			e = protowire.AppendBytes(e, ts)
+			e = protowire.AppendTag(e, 2, protowire.BytesType)
+			e = protowire.AppendString(e, entry.Message)
+
+			s = protowire.AppendTag(s, 2, protowire.BytesType)
+			s = protowire.AppendBytes(s, e)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, s)
+	}
+	return req
+}
+
+func encodeLokiJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+
+	for _, stream := range streams {
+		js := jsonStream{Stream: parseLokiLabels(stream.labels)}
+		for _, entry := range stream.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(entry.Timestamp.UnixNano(), 10), entry.Message})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// parseLokiLabels turns the rendered stream labels back into a map for the
+// JSON format.
+func parseLokiLabels(labels string) map[string]string {
+	m := make(map[string]string)
+	rest := strings.TrimSuffix(strings.TrimPrefix(labels, "{"), "}")
+	for rest != "" {
+		name, value, _ := strings.Cut(rest, "=")
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			break
+		}
+		m[strings.TrimSpace(name)], _ = strconv.Unquote(quoted)
+		rest = strings.TrimPrefix(value[len(quoted):], ", ")
+	}
+	return m
+}
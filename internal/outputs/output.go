@@ -1,6 +1,12 @@
 package outputs
 
+import "log-agent/internal/pipeline"
+
+// Output receives every processed entry alongside the primary sender.
+// Write must not block on the network: batching outputs queue the entry and
+// return an error only when it could not be queued. Close delivers what is
+// queued and reports the entries that could not be delivered.
 type Output interface {
-	Write(logEntry string)
-	Close()
+	Write(entry *pipeline.LogEntry) error
+	Close() error
 }
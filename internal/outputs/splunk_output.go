@@ -0,0 +1,328 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"log-agent/internal/config"
+	"log-agent/internal/pipeline"
+
+	"github.com/google/uuid"
+)
+
+const (
+	splunkEventPath = "/services/collector/event"
+	splunkAckPath   = "/services/collector/ack"
+
+	splunkAckPollInterval = time.Second
+	splunkAckTimeout      = time.Minute
+)
+
+// SplunkOutput sends entries to a Splunk HTTP Event Collector. With indexer
+// acknowledgment a batch only counts as delivered once Splunk reports it
+// indexed: sent batches wait in pending while the batcher keeps sending, a
+// separate goroutine polls their acks together, and batches that are never
+// acknowledged are sent again.
+type SplunkOutput struct {
+	url        string
+	token      string
+	index      string
+	source     *tagTemplate
+	sourcetype string
+	ack        bool
+	channel    string
+	client     *http.Client
+	batcher    *batcher
+
+	mu       sync.Mutex
+	pending  map[int64]*splunkBatch
+	unsent   []*splunkBatch // resends that failed, tried again on the next poll
+	dropped  int
+	closing  chan struct{}
+	acksDone chan struct{}
+}
+
+// splunkBatch is a batch sent with indexer acknowledgment.
+type splunkBatch struct {
+	entries  []pipeline.LogEntry
+	sent     time.Time
+	attempts int
+}
+
+type splunkEvent struct {
+	Time       json.Number       `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Sourcetype string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      string            `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+func NewSplunkOutput(cfg config.Config) (*SplunkOutput, error) {
+	tlsConfig, err := newTLSConfig(cfg.SplunkHECTLSCA, cfg.SplunkHECTLSInsecure)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	so := &SplunkOutput{
+		url:        strings.TrimSuffix(cfg.SplunkHECURL, "/"),
+		token:      cfg.SplunkHECToken,
+		index:      cfg.SplunkHECIndex,
+		source:     parseTagTemplate(cfg.SplunkHECSource),
+		sourcetype: cfg.SplunkHECSourcetype,
+		ack:        cfg.SplunkHECAck,
+		// The channel identifies this agent's acks; Splunk requires it with
+		// indexer acknowledgment enabled.
+		channel:  uuid.New().String(),
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		pending:  make(map[int64]*splunkBatch),
+		closing:  make(chan struct{}),
+		acksDone: make(chan struct{}),
+	}
+	so.batcher = newBatcher("Splunk HEC", cfg.OutputBatchSize, cfg.OutputFlushInterval, so.flush)
+	if so.ack {
+		go so.pollAcks()
+	} else {
+		close(so.acksDone)
+	}
+	return so, nil
+}
+
+func (so *SplunkOutput) Write(entry *pipeline.LogEntry) error {
+	return so.batcher.add(entry)
+}
+
+// Close flushes the queue and waits up to splunkAckTimeout for the acks of
+// the batches still pending.
+func (so *SplunkOutput) Close() error {
+	err := so.batcher.close()
+	close(so.closing)
+	<-so.acksDone
+
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if so.dropped > 0 {
+		err = errors.Join(err, fmt.Errorf("Splunk HEC output dropped %d unacknowledged entries", so.dropped))
+	}
+	return err
+}
+
+func (so *SplunkOutput) flush(batch []pipeline.LogEntry) ([]pipeline.LogEntry, error) {
+	ackID, retryable, err := so.send(batch)
+	if err != nil {
+		if retryable {
+			return batch, err
+		}
+		return nil, err
+	}
+	if so.ack {
+		// The batcher reuses batch once flush returns.
+		entries := append([]pipeline.LogEntry(nil), batch...)
+		so.mu.Lock()
+		so.pending[ackID] = &splunkBatch{entries: entries, sent: time.Now(), attempts: 1}
+		so.mu.Unlock()
+	}
+	return nil, nil
+}
+
+// send posts a batch and returns its ackId when acknowledgment is enabled.
+// The bool reports whether a failed request is worth retrying.
+func (so *SplunkOutput) send(batch []pipeline.LogEntry) (int64, bool, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, entry := range batch {
+		if err := enc.Encode(so.event(&entry)); err != nil {
+			return 0, false, fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+	}
+
+	var resp splunkResponse
+	if retryable, err := so.post(splunkEventPath, body.Bytes(), &resp); err != nil {
+		return 0, retryable, err
+	}
+	if !so.ack {
+		return 0, false, nil
+	}
+	if resp.AckID == nil {
+		return 0, false, fmt.Errorf("no ackId in response, is indexer acknowledgment enabled for the token?")
+	}
+	return *resp.AckID, false, nil
+}
+
+// pollAcks checks the pending batches every splunkAckPollInterval until
+// the output is closed and nothing is pending, or splunkAckTimeout after
+// closing, when whatever is left counts as dropped.
+func (so *SplunkOutput) pollAcks() {
+	defer close(so.acksDone)
+	ticker := time.NewTicker(splunkAckPollInterval)
+	defer ticker.Stop()
+
+	closing := so.closing
+	var deadline <-chan time.Time
+	for {
+		select {
+		case <-ticker.C:
+			so.checkAcks()
+		case <-closing:
+			closing = nil
+			deadline = time.After(splunkAckTimeout)
+		case <-deadline:
+			so.mu.Lock()
+			left := 0
+			for _, b := range so.pending {
+				left += len(b.entries)
+			}
+			for _, b := range so.unsent {
+				left += len(b.entries)
+			}
+			so.dropped += left
+			so.mu.Unlock()
+			log.Printf("[ERROR] Splunk HEC output dropped %d entries still waiting for acks.", left)
+			return
+		}
+
+		if closing == nil && so.idle() {
+			return
+		}
+	}
+}
+
+func (so *SplunkOutput) idle() bool {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	return len(so.pending) == 0 && len(so.unsent) == 0
+}
+
+// checkAcks asks for the status of every pending ackId in one request and
+// sends again the batches that timed out.
+func (so *SplunkOutput) checkAcks() {
+	so.mu.Lock()
+	ids := make([]int64, 0, len(so.pending))
+	for id := range so.pending {
+		ids = append(ids, id)
+	}
+	resend := so.unsent
+	so.unsent = nil
+	so.mu.Unlock()
+
+	if len(ids) > 0 {
+		request, _ := json.Marshal(map[string][]int64{"acks": ids})
+		var resp struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if _, err := so.post(splunkAckPath, request, &resp); err != nil {
+			log.Printf("[WARNING] Failed to poll Splunk HEC acks: %v", err)
+		}
+
+		so.mu.Lock()
+		for _, id := range ids {
+			b := so.pending[id]
+			switch {
+			case resp.Acks[strconv.FormatInt(id, 10)]:
+				delete(so.pending, id)
+			case time.Since(b.sent) >= splunkAckTimeout:
+				delete(so.pending, id)
+				resend = append(resend, b)
+			}
+		}
+		so.mu.Unlock()
+	}
+
+	for _, b := range resend {
+		so.resend(b)
+	}
+}
+
+// resend sends a batch again, giving up after maxFlushAttempts sends.
+func (so *SplunkOutput) resend(b *splunkBatch) {
+	if b.attempts >= maxFlushAttempts {
+		log.Printf("[ERROR] Splunk HEC output dropped %d entries after %d attempts without an ack.", len(b.entries), b.attempts)
+		so.mu.Lock()
+		so.dropped += len(b.entries)
+		so.mu.Unlock()
+		return
+	}
+
+	b.attempts++
+	log.Printf("[WARNING] Splunk HEC did not acknowledge %d entries within %s, sending them again.", len(b.entries), splunkAckTimeout)
+	ackID, _, err := so.send(b.entries)
+
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if err != nil {
+		log.Printf("[WARNING] Failed to send %d entries to Splunk HEC again: %v", len(b.entries), err)
+		so.unsent = append(so.unsent, b)
+		return
+	}
+	b.sent = time.Now()
+	so.pending[ackID] = b
+}
+
+// post sends a request to the collector and decodes its JSON response. The
+// returned bool reports whether a failed request is worth retrying.
+func (so *SplunkOutput) post(path string, body []byte, out interface{}) (bool, error) {
+	req, err := http.NewRequest("POST", so.url+path, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+so.token)
+	req.Header.Set("X-Splunk-Request-Channel", so.channel)
+
+	resp, err := so.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return true, fmt.Errorf("decoding response: %w", err)
+	}
+	return false, nil
+}
+
+// event maps an entry to HEC's event format. Labels become indexed fields,
+// except host_name, which is the event's host.
+func (so *SplunkOutput) event(entry *pipeline.LogEntry) splunkEvent {
+	fields := make(map[string]string, len(entry.Labels)+2)
+	for k, v := range entry.Labels {
+		fields[k] = v
+	}
+	delete(fields, "host_name")
+	fields["level"] = entry.Level
+	fields["classification"] = entry.Classification
+
+	ts := entry.Timestamp
+	return splunkEvent{
+		Time:       json.Number(fmt.Sprintf("%d.%06d", ts.Unix(), ts.Nanosecond()/1000)),
+		Host:       entry.Labels["host_name"],
+		Source:     so.source.expand(entry.Labels),
+		Sourcetype: so.sourcetype,
+		Index:      so.index,
+		Event:      entry.Message,
+		Fields:     fields,
+	}
+}
@@ -0,0 +1,124 @@
+package outputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"log-agent/internal/config"
+)
+
+// fakeHEC assigns an ackId to every event request and reports acks indexed
+// only once it has received ackAfter event requests.
+type fakeHEC struct {
+	ackAfter int
+
+	mu          sync.Mutex
+	events      int
+	ackRequests [][]int64
+}
+
+func (h *fakeHEC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch r.URL.Path {
+	case splunkEventPath:
+		if r.Header.Get("X-Splunk-Request-Channel") == "" {
+			http.Error(w, `{"text":"Data channel is missing","code":10}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, h.events)
+		h.events++
+	case splunkAckPath:
+		var req struct {
+			Acks []int64 `json:"acks"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		h.ackRequests = append(h.ackRequests, req.Acks)
+		acks := map[string]bool{}
+		for _, id := range req.Acks {
+			acks[fmt.Sprint(id)] = h.events >= h.ackAfter
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"acks": acks})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func splunkTestConfig(url string) config.Config {
+	return config.Config{
+		SplunkHECURL:        url,
+		SplunkHECToken:      "token",
+		SplunkHECSource:     "loggyto",
+		SplunkHECAck:        true,
+		OutputBatchSize:     1,
+		OutputFlushInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestSplunkOutputSendsWhileAcksArePending(t *testing.T) {
+	hec := &fakeHEC{ackAfter: 3}
+	srv := httptest.NewServer(hec)
+	defer srv.Close()
+
+	so, err := NewSplunkOutput(splunkTestConfig(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := so.Write(testEntry(msg, nil)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	// All three batches go out before the first is acknowledged.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hec.mu.Lock()
+		events := hec.events
+		hec.mu.Unlock()
+		if events == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of 3 batches sent while acks were pending", events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := so.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	hec.mu.Lock()
+	defer hec.mu.Unlock()
+	if len(hec.ackRequests) != 1 || len(hec.ackRequests[0]) != 3 {
+		t.Errorf("ack requests = %v, want one request for all three ackIds", hec.ackRequests)
+	}
+	if hec.events != 3 {
+		t.Errorf("got %d event requests, want 3 without resends", hec.events)
+	}
+}
+
+func TestSplunkOutputCloseReportsMissingAckID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer srv.Close()
+
+	so, err := NewSplunkOutput(splunkTestConfig(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := so.Write(testEntry("lost", nil)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := so.Close(); err == nil || !strings.Contains(err.Error(), "dropped 1 entries") {
+		t.Errorf("Close() error = %v, want the dropped entry reported", err)
+	}
+}
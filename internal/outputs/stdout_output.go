@@ -1,6 +1,11 @@
 package outputs
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+
+	"log-agent/internal/pipeline"
+)
 
 type StdoutOutput struct{}
 
@@ -8,10 +13,16 @@ func NewStdoutOutput() *StdoutOutput {
 	return &StdoutOutput{}
 }
 
-func (o *StdoutOutput) Write(logEntry string) {
-	fmt.Println(logEntry)
+func (o *StdoutOutput) Write(entry *pipeline.LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
 }
 
-func (o *StdoutOutput) Close() {
+func (o *StdoutOutput) Close() error {
 	fmt.Println("Closing Stdout Output...")
+	return nil
 }
@@ -51,6 +51,22 @@ func DetectLogLevel(msg string) string {
 	return "INFO"
 }
 
+// SyslogLevel maps a syslog severity (0 emerg to 7 debug) to a level, for
+// sources that record it explicitly instead of leaving it to be guessed.
+func SyslogLevel(severity int) string {
+	switch {
+	case severity < 0 || severity > 7:
+		return ""
+	case severity <= 3:
+		return "ERROR"
+	case severity == 4:
+		return "WARN"
+	case severity <= 6:
+		return "INFO"
+	}
+	return "DEBUG"
+}
+
 func detectFromJSON(msg string) string {
 	if !strings.HasPrefix(msg, "{") {
 		return ""
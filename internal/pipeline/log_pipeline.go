@@ -17,6 +17,19 @@ type LogEntry struct {
 	TimestampInferred bool              `json:"timestamp_inferred"`
 }
 
+// EntryHints carries values a collector already knows authoritatively, so the
+// pipeline uses them instead of guessing from the message text.
+type EntryHints struct {
+	Timestamp time.Time
+	Level     string
+	// SkipSplit marks raw as exactly one message, e.g. after multiline
+	// aggregation or structured parsing.
+	SkipSplit bool
+	// SkipDedup ships raw even if the same message was just seen, for
+	// sources where a repeat is a new event, like a container dying again.
+	SkipDedup bool
+}
+
 type Pipeline struct {
 	Splitter      func(string) []string
 	Formatter     func(string) string
@@ -50,8 +63,18 @@ func NewPipeline(
 	}
 }
 
-func (p *Pipeline) Process(raw string, metadata map[string]string) {
-	lines := p.Splitter(raw)
+func (p *Pipeline) Process(raw string, metadata map[string]string) error {
+	return p.ProcessWithHints(raw, metadata, EntryHints{})
+}
+
+// ProcessWithHints returns the first delivery error, so callers can tell
+// whether raw reached the sender before advancing any checkpoint.
+func (p *Pipeline) ProcessWithHints(raw string, metadata map[string]string, hints EntryHints) error {
+	var sendErr error
+	lines := []string{raw}
+	if !hints.SkipSplit {
+		lines = p.Splitter(raw)
+	}
 
 	for _, line := range lines {
 		formatted := p.Formatter(line)
@@ -61,13 +84,19 @@ func (p *Pipeline) Process(raw string, metadata map[string]string) {
 
 		formatted = p.Redactor(formatted)
 
-		if !p.Deduplicator(formatted) {
+		if !hints.SkipDedup && !p.Deduplicator(formatted) {
 			continue
 		}
 
 		level := p.LevelDetector(formatted)
 		classification := p.Classifier(formatted)
 		ts, inferred := p.TimestampFunc(formatted)
+		if !hints.Timestamp.IsZero() {
+			ts, inferred = hints.Timestamp.UTC(), false
+		}
+		if hints.Level != "" {
+			level = hints.Level
+		}
 
 		entry := &LogEntry{
 			Message:           formatted,
@@ -81,6 +110,10 @@ func (p *Pipeline) Process(raw string, metadata map[string]string) {
 
 		if err := p.Sender(entry); err != nil {
 			log.Printf("[ERROR] Failed to send log entry: %v | entry=%+v", err, entry)
+			if sendErr == nil {
+				sendErr = err
+			}
 		}
 	}
+	return sendErr
 }
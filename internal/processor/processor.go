@@ -1,6 +1,8 @@
 package processor
 
 import (
+	"time"
+
 	"log-agent/internal/pipeline"
 )
 
@@ -12,8 +14,48 @@ func NewLogProcessor(p *pipeline.Pipeline) *LogProcessor {
 	return &LogProcessor{pipeline: p}
 }
 
-func (lp *LogProcessor) ProcessLog(source, logData string, metadata map[string]string) {
-	lp.pipeline.Process(logData, metadata)
+func (lp *LogProcessor) ProcessLog(source, logData string, metadata map[string]string) error {
+	return lp.pipeline.Process(logData, metadata)
+}
+
+func (lp *LogProcessor) ProcessLogAt(source, logData string, ts time.Time, metadata map[string]string) error {
+	return lp.pipeline.ProcessWithHints(logData, metadata, pipeline.EntryHints{Timestamp: ts})
+}
+
+func (lp *LogProcessor) ProcessLogWithHints(source, logData string, hints pipeline.EntryHints, metadata map[string]string) error {
+	return lp.pipeline.ProcessWithHints(logData, metadata, hints)
+}
+
+// ProcessJSONLog handles sources known to log JSON objects: message, level
+// and timestamp come from the object's fields and the remaining fields are
+// added as labels. Lines that aren't JSON objects are processed as usual.
+func (lp *LogProcessor) ProcessJSONLog(source, logData string, hints pipeline.EntryHints, metadata map[string]string) error {
+	parsed, ok := TryParseJSONLog(logData)
+	if !ok {
+		return lp.ProcessLogWithHints(source, logData, hints, metadata)
+	}
+
+	message := parsed.Message
+	if message == "" {
+		message = logData
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, parsed.Timestamp); err == nil {
+		hints.Timestamp = ts
+	}
+	if parsed.Level != "" {
+		hints.Level = parsed.Level
+	}
+	hints.SkipSplit = true
+
+	labels := make(map[string]string, len(metadata)+len(parsed.Metadata))
+	for k, v := range parsed.Metadata {
+		labels[k] = v
+	}
+	for k, v := range metadata {
+		labels[k] = v
+	}
+
+	return lp.pipeline.ProcessWithHints(message, labels, hints)
 }
 
 func (lp *LogProcessor) Flush(containerID string) (any, bool) {
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CheckpointStore keeps per-source resume positions (timestamps, cursors,
+// offsets) in memory and periodically persists them to a JSON state file.
+type CheckpointStore struct {
+	path     string
+	values   map[string]string
+	dirty    bool
+	mu       sync.Mutex
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+func NewCheckpointStore(path string, flushInterval time.Duration) *CheckpointStore {
+	s := &CheckpointStore{
+		path:     path,
+		values:   make(map[string]string),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &s.values); err != nil {
+			log.Printf("[WARNING] Ignoring corrupt state file %s: %v", path, err)
+			s.values = make(map[string]string)
+		}
+	case !os.IsNotExist(err):
+		log.Printf("[WARNING] Failed to read state file %s: %v", path, err)
+	}
+
+	go s.flushLoop(flushInterval)
+	return s
+}
+
+func (s *CheckpointStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+func (s *CheckpointStore) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values[key] == value {
+		return
+	}
+	s.values[key] = value
+	s.dirty = true
+}
+
+func (s *CheckpointStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return
+	}
+	delete(s.values, key)
+	s.dirty = true
+}
+
+// Flush writes the state file if anything changed since the last flush. The
+// file is replaced atomically so a crash never leaves a partial file behind.
+func (s *CheckpointStore) Flush() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s.values)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		s.markDirty()
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		s.markDirty()
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		s.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (s *CheckpointStore) Close() {
+	close(s.stopChan)
+	<-s.done
+	if err := s.Flush(); err != nil {
+		log.Printf("[ERROR] Failed to write state file %s: %v", s.path, err)
+	}
+}
+
+func (s *CheckpointStore) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+func (s *CheckpointStore) flushLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("[ERROR] Failed to write state file %s: %v", s.path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+)
+
+// ContainerRegistry shares container metadata between collectors, e.g. so the
+// journald collector can label entries written by Docker's journald driver
+// the same way the Docker collector labels streamed entries.
+type ContainerRegistry struct {
+	mu         sync.RWMutex
+	containers map[string]map[string]string
+}
+
+func NewContainerRegistry() *ContainerRegistry {
+	return &ContainerRegistry{
+		containers: make(map[string]map[string]string),
+	}
+}
+
+func (r *ContainerRegistry) Register(containerID string, metadata map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.containers[containerID] = metadata
+}
+
+func (r *ContainerRegistry) Unregister(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.containers, containerID)
+}
+
+// Lookup accepts a full container ID or the 12 character short form.
+func (r *ContainerRegistry) Lookup(containerID string) (map[string]string, bool) {
+	if containerID == "" {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if meta, ok := r.containers[containerID]; ok {
+		return meta, true
+	}
+	for id, meta := range r.containers {
+		if strings.HasPrefix(id, containerID) {
+			return meta, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const DefaultMaxLineBytes = 256 * 1024
+
+// LineReader splits a stream into newline-terminated lines. Lines longer than
+// maxBytes are cut at the limit and the rest of the line is discarded.
+type LineReader struct {
+	reader   *bufio.Reader
+	maxBytes int
+}
+
+func NewLineReader(r io.Reader, maxBytes int) *LineReader {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxLineBytes
+	}
+	return &LineReader{
+		reader:   bufio.NewReaderSize(r, 64*1024),
+		maxBytes: maxBytes,
+	}
+}
+
+// ReadLine returns the next line without its line terminator. truncated is
+// set when the line exceeded the configured maximum. A final line without a
+// trailing newline is returned before io.EOF.
+func (lr *LineReader) ReadLine() (line string, truncated bool, err error) {
+	var buf []byte
+
+	for {
+		chunk, readErr := lr.reader.ReadSlice('\n')
+		complete := readErr == nil
+		if complete {
+			chunk = chunk[:len(chunk)-1]
+		}
+
+		room := lr.maxBytes - len(buf)
+		if len(chunk) > room {
+			chunk = chunk[:room]
+			truncated = true
+		}
+		buf = append(buf, chunk...)
+
+		switch {
+		case complete:
+			return trimCarriageReturn(buf), truncated, nil
+		case errors.Is(readErr, bufio.ErrBufferFull):
+			continue
+		case len(buf) > 0 || truncated:
+			return trimCarriageReturn(buf), truncated, nil
+		default:
+			return "", false, readErr
+		}
+	}
+}
+
+func trimCarriageReturn(b []byte) string {
+	if n := len(b); n > 0 && b[n-1] == '\r' {
+		b = b[:n-1]
+	}
+	return string(b)
+}
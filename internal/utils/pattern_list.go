@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// PatternList matches values against exact names, globs (`api-*`) or
+// regular expressions wrapped in slashes (`/^worker-\d+$/`). Unlike shell
+// globs, `*` also matches slashes, so `myregistry.io/*` and `*nginx*` match
+// images like `myregistry.io/team/nginx:1.2`.
+type PatternList struct {
+	regexps []*regexp.Regexp
+}
+
+func NewPatternList(patterns []string) *PatternList {
+	pl := &PatternList{}
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				log.Printf("[WARNING] Ignoring invalid pattern %q: %v", p, err)
+				continue
+			}
+			pl.regexps = append(pl.regexps, re)
+			continue
+		}
+		re, err := globToRegexp(p)
+		if err != nil {
+			log.Printf("[WARNING] Ignoring invalid pattern %q: %v", p, err)
+			continue
+		}
+		pl.regexps = append(pl.regexps, re)
+	}
+	return pl
+}
+
+func (pl *PatternList) Empty() bool {
+	return len(pl.regexps) == 0
+}
+
+func (pl *PatternList) Match(value string) bool {
+	for _, re := range pl.regexps {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp translates a glob with `*`, `?`, `[...]` classes and
+// backslash escapes into an anchored regular expression.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 == len(glob) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
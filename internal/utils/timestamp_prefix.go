@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+// SplitTimestampPrefix separates the RFC3339Nano prefix that Docker and the
+// kubelet add when logs are requested with timestamps from the original line.
+func SplitTimestampPrefix(line string) (time.Time, string, bool) {
+	prefix, msg, found := strings.Cut(line, " ")
+	if !found {
+		prefix, msg = line, ""
+	}
+	ts, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, msg, true
+}